@@ -0,0 +1,184 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrAddrRecMixedVer    = errors.New("EA and IP are different versions")
+	ErrAddrRecZeroAddr    = errors.New("zero address")
+	ErrAddrRecNonGlobalGW = errors.New("GW is not a globally reachable address")
+	ErrAddrRecZeroRef     = errors.New("zero ref")
+)
+
+// Reports which field of an AddrRec is invalid. Err is ErrUninitialized or one
+// of the ErrAddrRec errors.
+type AddrRecError struct {
+	Field string // "ea", "ip", "gw" or "ref"
+	Err   error
+}
+
+func (e *AddrRecError) Error() string {
+	return "invalid addrrec " + e.Field + ": " + e.Err.Error()
+}
+
+func (e *AddrRecError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the first problem found, as an *AddrRecError, or nil.
+func (arec AddrRec) Validate() error {
+
+	for _, f := range []struct {
+		name string
+		ip   IP
+	}{
+		{"ea", arec.EA},
+		{"ip", arec.IP},
+		{"gw", arec.GW},
+	} {
+		if f.ip.IsZero() {
+			return &AddrRecError{f.name, ErrUninitialized}
+		}
+		if f.ip.IsZeroAddr() {
+			return &AddrRecError{f.name, ErrAddrRecZeroAddr}
+		}
+	}
+	if arec.EA.Ver() != arec.IP.Ver() {
+		return &AddrRecError{"ip", ErrAddrRecMixedVer}
+	}
+	if !arec.GW.Class().IsGlobal() {
+		return &AddrRecError{"gw", ErrAddrRecNonGlobalGW}
+	}
+	if arec.Ref.IsZero() {
+		return &AddrRecError{"ref", ErrAddrRecZeroRef}
+	}
+	return nil
+}
+
+// Returns ErrUninitialized or ErrIPVersionMismatch if the codecs can't encode
+// arec, nil otherwise. Unlike Validate, it accepts zero addresses, zero refs and
+// non-global gateways, which are valid on the wire.
+func (arec AddrRec) CheckEncodable() error {
+
+	if arec.EA.IsZero() || arec.IP.IsZero() || arec.GW.IsZero() {
+		return ErrUninitialized
+	}
+	if arec.EA.Is4() != arec.IP.Is4() {
+		return ErrIPVersionMismatch
+	}
+	return nil
+}
+
+// Formats as ea=10.240.0.5 ip=192.0.2.1 gw=198.51.100.1 ref=1-2
+func (arec AddrRec) String() string {
+	return "ea=" + arec.EA.String() + " ip=" + arec.IP.String() +
+		" gw=" + arec.GW.String() + " ref=" + arec.Ref.String()
+}
+
+// Parses the String() form. The fields may be in any order, but all must be
+// present. The result is not validated.
+func ParseAddrRec(s string) (arec AddrRec, err error) {
+
+	var seen [4]bool
+	for _, field := range strings.Fields(s) {
+		key, val, found := strings.Cut(field, "=")
+		if !found {
+			return AddrRec{}, errors.New("invalid addrrec field (missing '='): " + field)
+		}
+		var i int
+		switch key {
+		case "ea":
+			i = 0
+			arec.EA, err = ParseIP(val)
+		case "ip":
+			i = 1
+			arec.IP, err = ParseIP(val)
+		case "gw":
+			i = 2
+			arec.GW, err = ParseIP(val)
+		case "ref":
+			i = 3
+			arec.Ref, err = ParseRef(val)
+		default:
+			return AddrRec{}, errors.New("unknown addrrec field: " + key)
+		}
+		if err != nil {
+			return AddrRec{}, err
+		}
+		if seen[i] {
+			return AddrRec{}, errors.New("duplicate addrrec field: " + key)
+		}
+		seen[i] = true
+	}
+	if seen != [4]bool{true, true, true, true} {
+		return AddrRec{}, errors.New("addrrec requires ea, ip, gw and ref")
+	}
+	return arec, nil
+}
+
+func MustParseAddrRec(s string) AddrRec {
+
+	arec, err := ParseAddrRec(s)
+	if err != nil {
+		panic("invalid addrrec")
+	}
+	return arec
+}
+
+func (a AddrRec) Equal(b AddrRec) bool {
+	return a == b
+}
+
+func (a AddrRec) IpRef() IpRef {
+	return IpRef{a.IP, a.Ref}
+}
+
+// Orders by EA, then by IpRef, then by GW. Uninitialized IPs come first.
+func (a AddrRec) Compare(b AddrRec) int {
+
+	if c := ip_compare_zero(a.EA, b.EA); c != 0 {
+		return c
+	}
+	if c := a.IpRef().Compare(b.IpRef()); c != 0 {
+		return c
+	}
+	return ip_compare_zero(a.GW, b.GW)
+}
+
+// Orders by IpRef, then by EA, then by GW. Uninitialized IPs come first.
+func (a AddrRec) CompareIpRef(b AddrRec) int {
+
+	if c := a.IpRef().Compare(b.IpRef()); c != 0 {
+		return c
+	}
+	if c := ip_compare_zero(a.EA, b.EA); c != 0 {
+		return c
+	}
+	return ip_compare_zero(a.GW, b.GW)
+}
+
+// Orders by IP, then by Ref. Uninitialized IPs come first.
+func (a IpRef) Compare(b IpRef) int {
+
+	if c := ip_compare_zero(a.IP, b.IP); c != 0 {
+		return c
+	}
+	return Uint128(a.Ref).Cmp(Uint128(b.Ref))
+}
+
+func ip_compare_zero(a, b IP) int {
+
+	switch {
+	case a.IsZero() && b.IsZero():
+		return 0
+	case a.IsZero():
+		return -1
+	case b.IsZero():
+		return 1
+	}
+	return a.Compare(b)
+}
@@ -0,0 +1,60 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAddrRec(t *testing.T) {
+
+	s := "ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2"
+	arec, err := ParseAddrRec(s)
+	if err != nil {
+		t.Fatalf("unexpected error parsing %q: %v", s, err)
+	}
+	if arec.String() != s {
+		t.Errorf("expected %q, got %q", s, arec)
+	}
+	if err := arec.Validate(); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+	if x, err := ParseAddrRec("ref=1-2 gw=8.8.4.4 ip=192.0.2.1 ea=10.240.0.5"); err != nil || x != arec {
+		t.Errorf("reordered fields parsed as %v %v", x, err)
+	}
+	for _, s := range []string{"ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4",
+		"ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2 ea=10.240.0.6",
+		"ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2 x=1"} {
+		if _, err := ParseAddrRec(s); err == nil {
+			t.Errorf("expected error parsing %q", s)
+		}
+	}
+
+	test_cases := []struct {
+		arec  string
+		field string
+		err   error
+	}{
+		{"ea=fd00::5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2", "ip", ErrAddrRecMixedVer},
+		{"ea=0.0.0.0 ip=192.0.2.1 gw=8.8.4.4 ref=1-2", "ea", ErrAddrRecZeroAddr},
+		{"ea=10.240.0.5 ip=192.0.2.1 gw=10.0.0.1 ref=1-2", "gw", ErrAddrRecNonGlobalGW},
+		{"ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=0", "ref", ErrAddrRecZeroRef},
+	}
+	for i, c := range test_cases {
+		err := MustParseAddrRec(c.arec).Validate()
+		var aerr *AddrRecError
+		if !errors.As(err, &aerr) || aerr.Field != c.field || !errors.Is(err, c.err) {
+			t.Errorf("case %v: expected %v error %v, got %v", i, c.field, c.err, err)
+		}
+	}
+	if err := (AddrRec{}).Validate(); !errors.Is(err, ErrUninitialized) {
+		t.Errorf("expected ErrUninitialized, got %v", err)
+	}
+
+	a := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.9 gw=8.8.4.4 ref=1")
+	b := MustParseAddrRec("ea=10.240.0.6 ip=192.0.2.1 gw=8.8.4.4 ref=1")
+	if a.Compare(b) >= 0 || a.CompareIpRef(b) <= 0 || a.Compare(a) != 0 {
+		t.Errorf("unexpected ordering of %v and %v", a, b)
+	}
+}
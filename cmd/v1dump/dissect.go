@@ -0,0 +1,297 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package main
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"github.com/ipref/ref/oldv1"
+	"github.com/ipref/ref/v1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var be = binary.BigEndian
+
+type Field struct {
+	Name   string `json:"name"`
+	Offset int    `json:"offset"` // in the packet
+	Value  any    `json:"value,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type Packet struct {
+	N       int      `json:"n"`
+	Where   string   `json:"where,omitempty"` // input stream and offset
+	Version string   `json:"version"`         // oldv1, newv1, or v1 if it can't tell
+	Cmd     string   `json:"cmd"`
+	Mode    string   `json:"mode"`
+	PktID   uint16   `json:"pktid"`
+	PktLen  int      `json:"pktlen"`
+	IPVer   string   `json:"ipver,omitempty"`
+	Fields  []Field  `json:"fields,omitempty"`
+	Errors  []string `json:"errors,omitempty"`
+	Hex     string   `json:"hex,omitempty"` // of malformed packets
+}
+
+func (p *Packet) malformed() bool {
+
+	if len(p.Errors) > 0 {
+		return true
+	}
+	for _, f := range p.Fields {
+		if f.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes the packet field by field. codec is "oldv1", "newv1" or "auto".
+func dissect(pkt []byte, codec string) Packet {
+
+	var p Packet
+	if len(pkt) < V1_HDR_LEN {
+		p.Errors = append(p.Errors, "packet shorter than header")
+		p.Hex = hex.EncodeToString(pkt)
+		return p
+	}
+	var hdr V1Header
+	if err := hdr.Unmarshal(pkt); err != nil {
+		p.Errors = append(p.Errors, "header: " + err.Error())
+	}
+	p.Cmd = V1CmdName(pkt[V1_CMD])
+	p.Mode = V1ModeName(pkt[V1_CMD])
+	p.PktID = be.Uint16(pkt[V1_PKTID:])
+	p.PktLen = int(be.Uint16(pkt[V1_PKTLEN:])) * V1_PKTLEN_UNIT
+	if p.PktLen != len(pkt) {
+		p.Errors = append(p.Errors, fmt.Sprintf("V1_PKTLEN says %v bytes, packet has %v", p.PktLen, len(pkt)))
+	}
+
+	var codecs []AddrRecCodec
+	switch codec {
+	case "oldv1":
+		codecs = []AddrRecCodec{oldv1.Codec{}}
+	case "newv1":
+		codecs = []AddrRecCodec{newv1.Codec{}}
+	default:
+		codecs = []AddrRecCodec{v1.DetectCodec(pkt)}
+		if codecs[0].Name() == "oldv1" {
+			codecs = append(codecs, newv1.Codec{})
+		} else {
+			codecs = append(codecs, oldv1.Codec{})
+		}
+	}
+	// if the addrrecs don't decode in the detected version, try the other one,
+	// and if neither fits, report in the detected version
+	w := walker{pkt: pkt, off: V1_HDR_LEN, codec: codecs[0]}
+	w.walk()
+	if w.failed() && w.arecs_seen && len(codecs) > 1 {
+		w2 := walker{pkt: pkt, off: V1_HDR_LEN, codec: codecs[1]}
+		w2.walk()
+		if !w2.failed() {
+			w = w2
+		}
+	}
+	p.Fields = w.fields
+	p.Version = "v1"
+	if w.arecs_seen {
+		p.Version = w.codec.Name()
+	}
+	if p.Version != "newv1" && pkt[oldv1.V1_IPVER] != 0 {
+		p.IPVer = fmt.Sprintf("%02x", pkt[oldv1.V1_IPVER])
+	}
+	if p.malformed() {
+		p.Hex = hex.EncodeToString(pkt)
+	}
+	return p
+}
+
+type walker struct {
+	pkt        []byte
+	off        int
+	codec      AddrRecCodec
+	fields     []Field
+	arecs_seen bool
+}
+
+func (w *walker) failed() bool {
+
+	for _, f := range w.fields {
+		if f.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *walker) add(name string, value any, err string) {
+	w.fields = append(w.fields, Field{name, w.off, value, err})
+}
+
+func (w *walker) u32(name string) {
+
+	if len(w.pkt) - w.off < 4 {
+		w.add(name, nil, "truncated")
+		w.off = len(w.pkt)
+		return
+	}
+	w.add(name, be.Uint32(w.pkt[w.off:]), "")
+	w.off += 4
+}
+
+func (w *walker) u64(name string, format func(uint64) any) {
+
+	if len(w.pkt) - w.off < 8 {
+		w.add(name, nil, "truncated")
+		w.off = len(w.pkt)
+		return
+	}
+	w.add(name, format(be.Uint64(w.pkt[w.off:])), "")
+	w.off += 8
+}
+
+func hash_value(x uint64) any {
+	return fmt.Sprintf("%016x", x)
+}
+
+func time_base_value(x uint64) any {
+	return fmt.Sprintf("%v (%v)", TimeBase(x).Time().Format(time.RFC3339), int64(x))
+}
+
+// An item which should be of the type.
+func (w *walker) item(name string, typ byte) {
+
+	t, val, n, err := DecodeV1Item(w.pkt[w.off:])
+	if err != nil {
+		w.add(name, nil, "item: " + err.Error())
+		w.off = len(w.pkt)
+		return
+	}
+	errs := ""
+	if t != typ {
+		errs = "expected " + V1ItemName(typ) + " item, got " + V1ItemName(t)
+	}
+	w.add(name, item_value(t, val), errs)
+	w.off += n
+}
+
+// Items to the end of the packet.
+func (w *walker) items(name string) {
+	for w.off < len(w.pkt) {
+		t, val, n, err := DecodeV1Item(w.pkt[w.off:])
+		if err != nil {
+			w.add(name, nil, "item: " + err.Error())
+			w.off = len(w.pkt)
+			return
+		}
+		w.add(name, item_value(t, val), "")
+		w.off += n
+	}
+}
+
+func item_value(typ byte, val any) any {
+
+	switch x := val.(type) {
+	case string:
+		return fmt.Sprintf("%v %q", V1ItemName(typ), x)
+	case []byte:
+		return fmt.Sprintf("%v %x", V1ItemName(typ), x)
+	case nil:
+		return V1ItemName(typ)
+	}
+	return fmt.Sprintf("%v %v", V1ItemName(typ), val)
+}
+
+// Addrrecs to the end of the packet.
+func (w *walker) arecs() {
+
+	hdr := w.pkt[:V1_HDR_LEN]
+	for w.off < len(w.pkt) {
+		w.arecs_seen = true
+		n, arec, err := w.codec.Decode(hdr, w.pkt[w.off:])
+		if err != nil {
+			w.add("arec", nil, w.codec.Name() + ": " + err.Error())
+			w.off = len(w.pkt)
+			return
+		}
+		errs := ""
+		if err := arec.Validate(); err != nil && !placeholder(err) {
+			errs = err.Error()
+		}
+		w.add("arec", arec.String(), errs)
+		w.off += n
+	}
+}
+
+// Requests carry addrrecs with the unknown fields left zero, which is not an
+// error.
+func placeholder(err error) bool {
+	return errors.Is(err, ErrUninitialized) || errors.Is(err, ErrAddrRecZeroAddr) ||
+		errors.Is(err, ErrAddrRecZeroRef)
+}
+
+// Walks the payload, as laid out in package v1.
+func (w *walker) walk() {
+
+	cmd := w.pkt[V1_CMD] & V1_CMD_MASK
+	mode := w.pkt[V1_CMD] & V1_MODE_MASK
+	if mode == V1_NACK {
+		w.items("reason")
+		return
+	}
+	switch cmd {
+	case V1_NOOP:
+	case V1_SET_AREC:
+		w.u32("oid")
+		w.u32("mark")
+		if mode != V1_ACK {
+			w.arecs()
+		}
+	case V1_SET_MARK:
+		w.u32("oid")
+		w.u32("mark")
+	case V1_GET_REF, V1_GET_EA, V1_MC_GET_EA, V1_RECOVER_EA, V1_RECOVER_REF:
+		w.arecs()
+	case V1_SAVE_OID:
+		w.u32("oid")
+		if mode != V1_ACK {
+			w.item("name", V1_TYPE_STRING)
+		}
+	case V1_SAVE_TIME_BASE:
+		w.u32("oid")
+		if mode != V1_ACK {
+			w.u64("time base", time_base_value)
+		}
+	case V1_MC_HOST_DATA:
+		w.u32("batch id")
+		w.u64("hash", hash_value)
+		w.item("source", V1_TYPE_STRING)
+		w.arecs()
+	case V1_MC_HOST_DATA_HASH:
+		w.u32("count")
+		w.u64("hash", hash_value)
+		w.item("source", V1_TYPE_STRING)
+	case V1_SAVE_DNSSOURCE:
+		w.u32("oid")
+		if mode == V1_ACK {
+			w.u32("xmark")
+		} else {
+			w.u32("mark")
+		}
+		w.u64("hash", hash_value)
+		w.item("source", V1_TYPE_STRING)
+	default:
+		if w.off < len(w.pkt) {
+			w.add("payload", hex.EncodeToString(w.pkt[w.off:]), "unknown command")
+			w.off = len(w.pkt)
+		}
+	}
+	if w.off < len(w.pkt) {
+		w.add("trailing", hex.EncodeToString(w.pkt[w.off:]), "unexpected bytes after payload")
+		w.off = len(w.pkt)
+	}
+}
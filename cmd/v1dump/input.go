@@ -0,0 +1,158 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package main
+
+import (
+	. "github.com/ipref/ref"
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"strings"
+)
+
+/*
+ * Input is split into chunks: byte streams, which may hold any number of
+ * packets, and datagrams, which hold one. Streams are framed by the V1 header,
+ * resyncing on the next plausible header after garbage.
+ *
+ * Hex dumps may be plain hex, xxd, hexdump -C, tcpdump -X, or socat -x output,
+ * eg. of a unix socket relayed with:
+ *
+ *	socat -x UNIX-LISTEN:/run/v1.sock,fork UNIX-CONNECT:/run/v1.sock.real 2>capture
+ *
+ * In socat captures, lines starting with '>' or '<' begin a transfer in one
+ * direction, and each direction is a separate stream.
+ */
+
+type chunk struct {
+	where    string
+	data     []byte
+	datagram bool
+}
+
+// A packet, or garbage between packets, at offset in its chunk
+type frame struct {
+	off     int
+	data    []byte
+	garbage bool
+}
+
+// Reports whether the input looks like a text hex dump rather than binary.
+func is_text(data []byte) bool {
+
+	if len(data) > 4096 {
+		data = data[:4096]
+	}
+	for _, c := range data {
+		if c >= 0x7f || (c < ' ' && c != '\n' && c != '\r' && c != '\t') {
+			return false
+		}
+	}
+	return true
+}
+
+// Parses a hex dump into streams, one per socat direction, or one if there are
+// no direction lines.
+func parse_hex(name string, text []byte) []chunk {
+
+	var chunks []chunk
+	index := make(map[string]int)
+	dir := ""
+	sc := bufio.NewScanner(bytes.NewReader(text))
+	sc.Buffer(nil, 1 << 20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '>' || line[0] == '<' {
+			dir = line[:1]
+			continue
+		}
+		data := hex_line(line)
+		if len(data) == 0 {
+			continue
+		}
+		where := name
+		if dir != "" {
+			where += " " + dir
+		}
+		i, ok := index[where]
+		if !ok {
+			i = len(chunks)
+			index[where] = i
+			chunks = append(chunks, chunk{where: where})
+		}
+		chunks[i].data = append(chunks[i].data, data...)
+	}
+	return chunks
+}
+
+// Returns the bytes of one line of a hex dump, skipping the offset and the
+// text column.
+func hex_line(line string) []byte {
+
+	if i := strings.IndexByte(line, '|'); i >= 0 {
+		// hexdump -C, the offset has no colon
+		line = line[:i]
+		if fields := strings.Fields(line); len(fields) > 1 {
+			line = strings.Join(fields[1:], " ")
+		}
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 0 && strings.HasSuffix(fields[0], ":") {
+		fields = fields[1:] // xxd, tcpdump -X
+	}
+	var data []byte
+	for i, f := range fields {
+		// the text column starts at the first token which isn't hex, or
+		// differs in length from the first token
+		if len(f) % 2 != 0 || (i > 0 && len(f) != len(fields[0])) {
+			break
+		}
+		b, err := hex.DecodeString(f)
+		if err != nil {
+			break
+		}
+		data = append(data, b...)
+	}
+	return data
+}
+
+// Splits the stream into packets and the garbage between them.
+func split(data []byte) []frame {
+
+	var frames []frame
+	off := 0
+	for off < len(data) {
+		if plausible(data[off:]) {
+			// a packet, possibly truncated at the end of the stream
+			var hdr V1Header
+			hdr.Unmarshal(data[off:]) // leaves zero PktLen if truncated
+			n := min(max(hdr.PktLen, V1_HDR_LEN), len(data) - off)
+			frames = append(frames, frame{off, data[off : off+n], false})
+			off += n
+			continue
+		}
+		next := off + 1
+		for next < len(data) && !plausible(data[next:]) {
+			next++
+		}
+		frames = append(frames, frame{off, data[off:next], true})
+		off = next
+	}
+	return frames
+}
+
+// Reports whether b starts with a V1 header, or what might be a truncated one.
+func plausible(b []byte) bool {
+
+	if len(b) == 0 {
+		return false
+	}
+	if len(b) < V1_HDR_LEN {
+		return b[0] == V1_SIG
+	}
+	var hdr V1Header
+	return hdr.Unmarshal(b) == nil
+}
@@ -0,0 +1,216 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+/*
+ * v1dump decodes V1 packets, for when gw and dns-agent disagree. It reads raw
+ * packets, a hex dump, a socat -x capture of a unix socket, or a pcap file,
+ * from the named file or stdin. For each packet, it prints the header and the
+ * payload fields, detecting oldv1 or newv1 from the packet. Malformed fields
+ * are flagged with **, and malformed packets are followed by their hex.
+ *
+ *	v1dump [-f auto|raw|hex|pcap] [-codec auto|oldv1|newv1] [-port N] [-json] [-x] [file]
+ *
+ * Exit status is 1 if any packet is malformed, 2 if the input can't be read.
+ */
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+type options struct {
+	format string
+	codec  string
+	port   uint
+	json   bool
+	hex    bool
+}
+
+func main() {
+
+	var opts options
+	flag.StringVar(&opts.format, "f", "auto", "input format: auto, raw, hex or pcap")
+	flag.StringVar(&opts.codec, "codec", "auto", "addrrec format: auto, oldv1 or newv1")
+	flag.UintVar(&opts.port, "port", 0, "pcap: only UDP or TCP packets from or to the port")
+	flag.BoolVar(&opts.json, "json", false, "print one JSON object per packet")
+	flag.BoolVar(&opts.hex, "x", false, "print the hex of every packet, not just malformed ones")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: v1dump [flags] [file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 || opts.port > 0xffff || !one_of(opts.format, "auto", "raw", "hex", "pcap") ||
+		!one_of(opts.codec, "auto", "oldv1", "newv1") {
+
+		flag.Usage()
+		os.Exit(2)
+	}
+	name := "stdin"
+	in := io.Reader(os.Stdin)
+	if flag.NArg() == 1 && flag.Arg(0) != "-" {
+		name = flag.Arg(0)
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "v1dump:", err)
+			os.Exit(2)
+		}
+		defer f.Close()
+		in = f
+	}
+	data, err := io.ReadAll(in)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "v1dump:", err)
+		os.Exit(2)
+	}
+	pkts, err := dump(name, data, opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "v1dump:", err) // what was read is still printed
+	}
+	malformed := false
+	for i := range pkts {
+		if opts.json {
+			print_json(os.Stdout, &pkts[i])
+		} else {
+			print_text(os.Stdout, &pkts[i])
+		}
+		malformed = malformed || pkts[i].malformed()
+	}
+	switch {
+	case err != nil:
+		os.Exit(2)
+	case malformed:
+		os.Exit(1)
+	}
+}
+
+func one_of(s string, choices ...string) bool {
+
+	for _, c := range choices {
+		if s == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Decodes the packets in the input.
+func dump(name string, data []byte, opts options) ([]Packet, error) {
+
+	format := opts.format
+	if format == "auto" {
+		switch {
+		case is_pcap(data):
+			format = "pcap"
+		case is_text(data):
+			format = "hex"
+		default:
+			format = "raw"
+		}
+	}
+	var chunks []chunk
+	var err error
+	switch format {
+	case "pcap":
+		chunks, err = parse_pcap(data, uint16(opts.port))
+	case "hex":
+		chunks = parse_hex(name, data)
+	default:
+		chunks = []chunk{{where: name, data: data}}
+	}
+	var pkts []Packet
+	add := func(p Packet, data []byte, where string) {
+		p.N = len(pkts) + 1
+		p.Where = where
+		if opts.hex && p.Hex == "" {
+			p.Hex = hex.EncodeToString(data)
+		}
+		pkts = append(pkts, p)
+	}
+	for _, c := range chunks {
+		if c.datagram {
+			if format == "pcap" && opts.port == 0 && !plausible(c.data) {
+				continue // not V1 traffic
+			}
+			add(dissect(c.data, opts.codec), c.data, c.where)
+			continue
+		}
+		frames := split(c.data)
+		if format == "pcap" && opts.port == 0 && !has_packets(frames) {
+			continue
+		}
+		for _, f := range frames {
+			where := fmt.Sprintf("%v+%v", c.where, f.off)
+			if f.garbage {
+				add(Packet{
+					Errors: []string{fmt.Sprintf("%v bytes skipped, not a V1 packet", len(f.data))},
+					Hex:    hex.EncodeToString(f.data),
+				}, f.data, where)
+			} else {
+				add(dissect(f.data, opts.codec), f.data, where)
+			}
+		}
+	}
+	return pkts, err
+}
+
+func has_packets(frames []frame) bool {
+
+	for _, f := range frames {
+		if !f.garbage {
+			return true
+		}
+	}
+	return false
+}
+
+func print_json(w io.Writer, p *Packet) {
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		panic(err) // Packet has only marshalable fields
+	}
+	fmt.Fprintf(w, "%s\n", b)
+}
+
+// Prints eg.
+//
+//	#1 stdin+0: newv1 GET_EA ACK id=12 len=36
+//	    +8   arec  ea=10.240.0.5 ip=192.0.2.1 gw=198.51.100.1 ref=1-2
+func print_text(w io.Writer, p *Packet) {
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "#%v %v:", p.N, p.Where)
+	if p.Cmd != "" {
+		fmt.Fprintf(&sb, " %v %v %v id=%v len=%v", p.Version, p.Cmd, p.Mode, p.PktID, p.PktLen)
+		if p.IPVer != "" {
+			fmt.Fprintf(&sb, " ipver=%v", p.IPVer)
+		}
+	}
+	sb.WriteByte('\n')
+	for _, e := range p.Errors {
+		fmt.Fprintf(&sb, " ** %v\n", e)
+	}
+	for _, f := range p.Fields {
+		mark := "   "
+		if f.Error != "" {
+			mark = " **"
+		}
+		fmt.Fprintf(&sb, "%v +%-4v %-10v", mark, f.Offset, f.Name)
+		if f.Value != nil {
+			fmt.Fprintf(&sb, " %v", f.Value)
+		}
+		if f.Error != "" {
+			fmt.Fprintf(&sb, " (%v)", f.Error)
+		}
+		sb.WriteByte('\n')
+	}
+	for i := 0; i < len(p.Hex); i += 64 {
+		fmt.Fprintf(&sb, "    %04x  %v\n", i / 2, p.Hex[i:min(i+64, len(p.Hex))])
+	}
+	io.WriteString(w, sb.String())
+}
@@ -0,0 +1,264 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package main
+
+import (
+	. "github.com/ipref/ref"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+/*
+ * Classic pcap files only, pcapng must be converted first, eg. with:
+ *
+ *	editcap -F pcap capture.pcapng capture.pcap
+ *
+ * UDP payloads are datagrams. TCP payloads are appended to the stream of their
+ * flow, in sequence order, dropping retransmitted bytes. IP fragments are not
+ * reassembled.
+ */
+
+const (
+	LINKTYPE_NULL       = 0
+	LINKTYPE_ETHERNET   = 1
+	LINKTYPE_RAW_OLD    = 12
+	LINKTYPE_RAW_BSD    = 14
+	LINKTYPE_RAW        = 101
+	LINKTYPE_LOOP       = 108
+	LINKTYPE_LINUX_SLL  = 113
+	LINKTYPE_USER0      = 147 // V1 packets without any encapsulation
+	LINKTYPE_LINUX_SLL2 = 276
+
+	PCAP_HDR_LEN = 24
+	PCAP_REC_LEN = 16
+)
+
+var (
+	ErrPcapNG    = errors.New("pcapng is not supported, convert with: editcap -F pcap")
+	ErrPcapMagic = errors.New("not a pcap file")
+	ErrPcapTrunc = errors.New("pcap file truncated")
+)
+
+// Reports whether the data starts with a pcap or pcapng magic number.
+func is_pcap(data []byte) bool {
+
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xd4c3b2a1, 0xa1b23c4d, 0x4d3cb2a1, 0x0a0d0d0a:
+		return true
+	}
+	return false
+}
+
+type tcp_flow struct {
+	index int    // in chunks
+	next  uint32 // next expected sequence number
+}
+
+// Extracts the V1 payloads of a pcap file. If port is non-zero, only UDP and
+// TCP packets from or to the port are included.
+func parse_pcap(data []byte, port uint16) ([]chunk, error) {
+
+	if len(data) < PCAP_HDR_LEN {
+		return nil, ErrPcapMagic
+	}
+	var bo binary.ByteOrder
+	switch binary.BigEndian.Uint32(data) {
+	case 0xa1b2c3d4, 0xa1b23c4d:
+		bo = binary.BigEndian
+	case 0xd4c3b2a1, 0x4d3cb2a1:
+		bo = binary.LittleEndian
+	case 0x0a0d0d0a:
+		return nil, ErrPcapNG
+	default:
+		return nil, ErrPcapMagic
+	}
+	linktype := bo.Uint32(data[20:]) & 0xffff
+	var chunks []chunk
+	flows := make(map[string]*tcp_flow)
+	off := PCAP_HDR_LEN
+	for n := 1; off < len(data); n++ {
+		if len(data) - off < PCAP_REC_LEN {
+			return chunks, ErrPcapTrunc
+		}
+		incl := int(bo.Uint32(data[off+8:]))
+		orig := int(bo.Uint32(data[off+12:]))
+		off += PCAP_REC_LEN
+		if len(data) - off < incl {
+			return chunks, ErrPcapTrunc
+		}
+		frame := data[off : off+incl]
+		off += incl
+		where := fmt.Sprintf("pcap #%v", n)
+		if incl < orig {
+			where += fmt.Sprintf(" (captured %v of %v bytes)", incl, orig)
+		}
+		if linktype == LINKTYPE_USER0 {
+			if len(frame) > 0 {
+				chunks = append(chunks, chunk{where, frame, true})
+			}
+			continue
+		}
+		ip := link_payload(linktype, frame)
+		if ip == nil {
+			continue
+		}
+		p, ok := parse_ip(ip)
+		if !ok || (port != 0 && p.src.Port != port && p.dst.Port != port) {
+			continue
+		}
+		where += " " + p.proto + " " + p.src.String() + " > " + p.dst.String()
+		if p.proto == "udp" {
+			if len(p.payload) > 0 {
+				chunks = append(chunks, chunk{where, p.payload, true})
+			}
+			continue
+		}
+		key := p.src.String() + " > " + p.dst.String()
+		flow, ok := flows[key]
+		if !ok {
+			flow = &tcp_flow{index: len(chunks), next: p.seq}
+			flows[key] = flow
+			chunks = append(chunks, chunk{where: "tcp " + key})
+		}
+		if p.syn {
+			flow.next = p.seq + 1
+			continue
+		}
+		payload := p.payload
+		if skip := flow.next - p.seq; int32(skip) > 0 {
+			if int(skip) >= len(payload) {
+				continue // retransmitted
+			}
+			payload = payload[skip:]
+		}
+		flow.next = p.seq + uint32(len(p.payload))
+		chunks[flow.index].data = append(chunks[flow.index].data, payload...)
+	}
+	return chunks, nil
+}
+
+// Returns the IP packet carried in the link layer frame, or nil.
+func link_payload(linktype uint32, frame []byte) []byte {
+
+	var ethertype uint16
+	switch linktype {
+	case LINKTYPE_NULL, LINKTYPE_LOOP:
+		if len(frame) < 4 {
+			return nil
+		}
+		return frame[4:] // address family, told by the IP version instead
+	case LINKTYPE_RAW, LINKTYPE_RAW_OLD, LINKTYPE_RAW_BSD:
+		return frame
+	case LINKTYPE_ETHERNET:
+		if len(frame) < 14 {
+			return nil
+		}
+		ethertype = be.Uint16(frame[12:])
+		frame = frame[14:]
+		for (ethertype == 0x8100 || ethertype == 0x88a8) && len(frame) >= 4 {
+			ethertype = be.Uint16(frame[2:]) // VLAN tag
+			frame = frame[4:]
+		}
+	case LINKTYPE_LINUX_SLL:
+		if len(frame) < 16 {
+			return nil
+		}
+		ethertype = be.Uint16(frame[14:])
+		frame = frame[16:]
+	case LINKTYPE_LINUX_SLL2:
+		if len(frame) < 20 {
+			return nil
+		}
+		ethertype = be.Uint16(frame[0:])
+		frame = frame[20:]
+	default:
+		return nil
+	}
+	if ethertype != 0x0800 && ethertype != 0x86dd {
+		return nil
+	}
+	return frame
+}
+
+type transport struct {
+	proto    string // "udp" or "tcp"
+	src, dst IPPort
+	seq      uint32 // tcp only
+	syn      bool
+	payload  []byte
+}
+
+// Parses an IPv4 or IPv6 packet carrying UDP or TCP. IPv6 extension headers
+// and IPv4 fragments are not supported.
+func parse_ip(pkt []byte) (transport, bool) {
+
+	var t transport
+	var proto byte
+	var src, dst, l4 []byte
+	if len(pkt) < 1 {
+		return t, false
+	}
+	switch pkt[0] >> 4 {
+	case 4:
+		if len(pkt) < 20 {
+			return t, false
+		}
+		ihl := int(pkt[0] & 0x0f) * 4
+		total := int(be.Uint16(pkt[2:]))
+		if ihl < 20 || total < ihl || total > len(pkt) {
+			return t, false
+		}
+		if be.Uint16(pkt[6:]) & 0x3fff != 0 {
+			return t, false // fragment
+		}
+		proto = pkt[9]
+		src, dst = pkt[12:16], pkt[16:20]
+		l4 = pkt[ihl:total]
+	case 6:
+		if len(pkt) < 40 {
+			return t, false
+		}
+		total := 40 + int(be.Uint16(pkt[4:]))
+		if total > len(pkt) {
+			return t, false
+		}
+		proto = pkt[6]
+		src, dst = pkt[8:24], pkt[24:40]
+		l4 = pkt[40:total]
+	default:
+		return t, false
+	}
+	switch proto {
+	case 17:
+		if len(l4) < 8 {
+			return t, false
+		}
+		ulen := int(be.Uint16(l4[4:]))
+		if ulen < 8 || ulen > len(l4) {
+			return t, false
+		}
+		t.proto = "udp"
+		t.payload = l4[8:ulen]
+	case 6:
+		if len(l4) < 20 {
+			return t, false
+		}
+		doff := int(l4[12] >> 4) * 4
+		if doff < 20 || doff > len(l4) {
+			return t, false
+		}
+		t.proto = "tcp"
+		t.seq = be.Uint32(l4[4:])
+		t.syn = l4[13] & 0x02 != 0
+		t.payload = l4[doff:]
+	default:
+		return t, false
+	}
+	t.src = IPPort{IP: IPFromSlice(src), Port: be.Uint16(l4[0:])}
+	t.dst = IPPort{IP: IPFromSlice(dst), Port: be.Uint16(l4[2:])}
+	return t, true
+}
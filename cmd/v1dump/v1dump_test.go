@@ -0,0 +1,335 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package main
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"github.com/ipref/ref/oldv1"
+	"github.com/ipref/ref/v1"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func test_packets(t *testing.T, codec AddrRecCodec) [][]byte {
+
+	arecs := []AddrRec{
+		MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2"),
+		MustParseAddrRec("ea=10.240.0.6 ip=192.0.2.2 gw=8.8.8.8 ref=3"),
+	}
+	zero := IPZero(4)
+	var pkts [][]byte
+	for _, m := range []v1.Message{
+		&v1.NoopReq{Head: v1.Head{PktID: 1}},
+		&v1.SetAddrRecReq{Head: v1.Head{PktID: 2}, OID: 7, Mark: 1000, AddrRecs: arecs},
+		&v1.GetEAReq{Head: v1.Head{PktID: 3}, AddrRecs: []AddrRec{{EA: zero, IP: arecs[0].IP, GW: zero, Ref: arecs[0].Ref}}},
+		&v1.SaveOIDReq{Head: v1.Head{PktID: 4}, OID: 7, Name: "mapper"},
+		&v1.SaveTimeBaseReq{Head: v1.Head{PktID: 5}, OID: 7, TimeBase: TimeBase(1700000000)},
+		&v1.HostData{Head: v1.Head{PktID: 6}, BatchID: 3, Hash: 0x1122334455667788,
+			Source: "/etc/hosts", AddrRecs: arecs},
+		&v1.HostDataHashReq{Head: v1.Head{PktID: 7}, Count: 2, Hash: 0x1122334455667788, Source: "/etc/hosts"},
+		&v1.SaveDNSSourceAck{Head: v1.Head{PktID: 8},
+			DNSSource: DNSSource{OID: 7, XMark: 1000, Hash: 99, Source: "example.com"}},
+		&v1.Nack{Head: v1.Head{PktID: 9}, Command: V1_SET_AREC, Reason: "no such oid"},
+	} {
+		pkt, err := m.MarshalV1(codec)
+		if err != nil {
+			t.Fatalf("%T: %v", m, err)
+		}
+		pkts = append(pkts, pkt)
+	}
+	return pkts
+}
+
+func field(p Packet, name string) *Field {
+
+	for i := range p.Fields {
+		if p.Fields[i].Name == name {
+			return &p.Fields[i]
+		}
+	}
+	return nil
+}
+
+func TestDissect(t *testing.T) {
+
+	for _, codec := range []AddrRecCodec{oldv1.Codec{}, newv1.Codec{}} {
+		pkts := test_packets(t, codec)
+		for _, pkt := range pkts {
+			p := dissect(pkt, "auto")
+			if p.malformed() {
+				t.Errorf("%v %v %v: unexpected malformed: %+v", codec.Name(), p.Cmd, p.Mode, p)
+			}
+			if field(p, "arec") != nil && p.Version != codec.Name() {
+				t.Errorf("%v %v: detected as %v", codec.Name(), p.Cmd, p.Version)
+			}
+		}
+		p := dissect(pkts[1], "auto")
+		if p.Cmd != "SET_AREC" || p.Mode != "REQ" || p.PktID != 2 || p.PktLen != len(pkts[1]) {
+			t.Errorf("%v: unexpected header: %+v", codec.Name(), p)
+		}
+		if f := field(p, "mark"); f == nil || f.Value != uint32(1000) || f.Offset != V1_HDR_LEN + V1_MARK {
+			t.Errorf("%v: unexpected mark: %+v", codec.Name(), f)
+		}
+		if f := field(p, "arec"); f == nil || f.Value != "ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2" {
+			t.Errorf("%v: unexpected arec: %+v", codec.Name(), f)
+		}
+		p = dissect(pkts[5], "auto")
+		if f := field(p, "source"); f == nil || f.Value != `STRING "/etc/hosts"` {
+			t.Errorf("%v: unexpected host data source: %+v", codec.Name(), f)
+		}
+		if f := field(p, "hash"); f == nil || f.Value != "1122334455667788" {
+			t.Errorf("%v: unexpected host data hash: %+v", codec.Name(), f)
+		}
+		p = dissect(pkts[7], "auto")
+		if f := field(p, "xmark"); f == nil || f.Value != uint32(1000) {
+			t.Errorf("%v: unexpected dnssource xmark: %+v", codec.Name(), f)
+		}
+	}
+
+	// malformed
+	pkt := test_packets(t, newv1.Codec{})[3] // SAVE_OID
+	for _, tc := range []struct {
+		pkt   []byte
+		field string
+	}{
+		{pkt[:len(pkt)-4], "name"},
+		{append(append([]byte(nil), pkt...), 1, 2, 3, 4), "trailing"},
+	} {
+		p := dissect(tc.pkt, "auto")
+		if !p.malformed() || len(p.Errors) == 0 || p.Hex == "" {
+			t.Errorf("%x: expected malformed packet: %+v", tc.pkt, p)
+		}
+		if f := field(p, tc.field); f == nil || f.Error == "" {
+			t.Errorf("%x: expected malformed %v: %+v", tc.pkt, tc.field, p)
+		}
+	}
+	bad := append([]byte(nil), pkt...)
+	bad[V1_HDR_LEN+4] = V1_TYPE_IPV4 // the name item
+	if f := field(dissect(bad, "auto"), "name"); f == nil || f.Error == "" {
+		t.Errorf("expected malformed name item: %+v", f)
+	}
+	// oldv1 addrrecs decoded as newv1
+	p := dissect(test_packets(t, oldv1.Codec{})[1], "newv1")
+	if !p.malformed() || p.Version != "newv1" {
+		t.Errorf("expected malformed newv1 packet: %+v", p)
+	}
+}
+
+func TestHexInput(t *testing.T) {
+
+	pkts := test_packets(t, newv1.Codec{})
+	want := append(append([]byte(nil), pkts[3]...), pkts[8]...)
+	xxd := ""
+	hexdump := ""
+	for off := 0; off < len(want); off += 16 {
+		line := want[off:min(off+16, len(want))]
+		xxd += fmt.Sprintf("%08x: ", off)
+		for i := 0; i < len(line); i += 2 {
+			xxd += fmt.Sprintf("%x ", line[i:min(i+2, len(line))])
+		}
+		xxd += fmt.Sprintf(" %q\n", strings.Repeat(".", len(line)))
+		hexdump += fmt.Sprintf("%08x  % x  |%v|\n", off, line, strings.Repeat(".", len(line)))
+	}
+	for _, text := range []string{
+		hex.EncodeToString(want),
+		"# comment\n" + fmt.Sprintf("% x", want[:20]) + "\n\n" + fmt.Sprintf("% x", want[20:]),
+		xxd,
+		hexdump,
+	} {
+		chunks := parse_hex("test", []byte(text))
+		if len(chunks) != 1 || !bytes.Equal(chunks[0].data, want) {
+			t.Errorf("%q: unexpected chunks: %+v", text, chunks)
+			continue
+		}
+		frames := split(chunks[0].data)
+		if len(frames) != 2 || frames[0].garbage || frames[1].garbage || frames[1].off != len(pkts[3]) {
+			t.Errorf("%q: unexpected frames: %+v", text, frames)
+		}
+	}
+
+	socat := "> 2025/06/01 10:00:00.000000  length=" + fmt.Sprint(len(pkts[3])) + " from=0 to=27\n" +
+		fmt.Sprintf(" % x\n", pkts[3]) +
+		"< 2025/06/01 10:00:00.001000  length=8 from=0 to=7\n" +
+		fmt.Sprintf(" % x\n", pkts[0]) +
+		"> 2025/06/01 10:00:00.002000  length=8 from=28 to=35\n" +
+		fmt.Sprintf(" % x\n", pkts[0])
+	chunks := parse_hex("test", []byte(socat))
+	if len(chunks) != 2 || chunks[0].where != "test >" || chunks[1].where != "test <" ||
+		!bytes.Equal(chunks[0].data, append(append([]byte(nil), pkts[3]...), pkts[0]...)) ||
+		!bytes.Equal(chunks[1].data, pkts[0]) {
+
+		t.Errorf("unexpected socat chunks: %+v", chunks)
+	}
+}
+
+func TestSplit(t *testing.T) {
+
+	pkts := test_packets(t, oldv1.Codec{})
+	var data []byte
+	data = append(data, 0, 1, 2)
+	data = append(data, pkts[1]...)
+	data = append(data, V1_SIG, 0xff, 0, 0, 0, 0, 0, 2) // unknown command
+	data = append(data, pkts[2]...)
+	data = append(data, pkts[3][:10]...)
+	frames := split(data)
+	var got []string
+	for _, f := range frames {
+		got = append(got, fmt.Sprintf("%v/%v/%v", f.off, len(f.data), f.garbage))
+	}
+	off1 := 3
+	off2 := off1 + len(pkts[1])
+	off3 := off2 + 8
+	off4 := off3 + len(pkts[2])
+	want := []string{
+		fmt.Sprintf("0/3/true"),
+		fmt.Sprintf("%v/%v/false", off1, len(pkts[1])),
+		fmt.Sprintf("%v/8/true", off2),
+		fmt.Sprintf("%v/%v/false", off3, len(pkts[2])),
+		fmt.Sprintf("%v/10/false", off4),
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("unexpected frames:\n got %v\nwant %v", got, want)
+	}
+	if p := dissect(frames[4].data, "auto"); !p.malformed() {
+		t.Errorf("expected truncated packet to be malformed: %+v", p)
+	}
+}
+
+// Returns a pcap file with the frames.
+func test_pcap(linktype uint32, frames ...[]byte) []byte {
+
+	le := binary.LittleEndian
+	var b []byte
+	b = le.AppendUint32(b, 0xa1b2c3d4)
+	b = le.AppendUint16(b, 2)
+	b = le.AppendUint16(b, 4)
+	b = le.AppendUint64(b, 0)
+	b = le.AppendUint32(b, 65535)
+	b = le.AppendUint32(b, linktype)
+	for i, f := range frames {
+		b = le.AppendUint32(b, uint32(1700000000 + i))
+		b = le.AppendUint32(b, 0)
+		b = le.AppendUint32(b, uint32(len(f)))
+		b = le.AppendUint32(b, uint32(len(f)))
+		b = append(b, f...)
+	}
+	return b
+}
+
+// Returns an IPv4 packet with the UDP or TCP payload.
+func test_ipv4(proto byte, sport, dport uint16, seq uint32, payload []byte) []byte {
+
+	var l4 []byte
+	l4 = be.AppendUint16(l4, sport)
+	l4 = be.AppendUint16(l4, dport)
+	if proto == 17 {
+		l4 = be.AppendUint16(l4, uint16(8 + len(payload)))
+		l4 = be.AppendUint16(l4, 0)
+	} else {
+		l4 = be.AppendUint32(l4, seq)
+		l4 = be.AppendUint32(l4, 0)
+		l4 = append(l4, 5 << 4, 0x18, 0, 0, 0, 0, 0, 0)
+	}
+	l4 = append(l4, payload...)
+	ip := []byte{0x45, 0, 0, 0, 0, 0, 0x40, 0, 64, proto, 0, 0, 192, 0, 2, 1, 192, 0, 2, 2}
+	be.PutUint16(ip[2:], uint16(20 + len(l4)))
+	return append(ip, l4...)
+}
+
+func TestPcapInput(t *testing.T) {
+
+	pkts := test_packets(t, newv1.Codec{})
+	eth := []byte{0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 6, 0x08, 0x00}
+	udp := append(append([]byte(nil), eth...), test_ipv4(17, 5000, 6000, 0, pkts[3])...)
+	dns := append(append([]byte(nil), eth...), test_ipv4(17, 5353, 53, 0, []byte("not v1 at all"))...)
+	data := test_pcap(LINKTYPE_ETHERNET, udp, dns)
+	if !is_pcap(data) {
+		t.Fatalf("pcap not detected")
+	}
+	got, err := dump("test", data, options{format: "auto", codec: "auto"})
+	if err != nil || len(got) != 1 || got[0].Cmd != "SAVE_OID" || got[0].malformed() ||
+		got[0].Where != "pcap #1 udp 192.0.2.1:5000 > 192.0.2.2:6000" {
+
+		t.Errorf("unexpected udp packets: %v %+v", err, got)
+	}
+	got, _ = dump("test", data, options{format: "pcap", codec: "auto", port: 53})
+	if len(got) != 1 || !got[0].malformed() {
+		t.Errorf("expected the port 53 datagram to be malformed: %+v", got)
+	}
+
+	// a tcp stream on loopback, with a packet split across segments, and
+	// a retransmitted segment
+	stream := append(append([]byte(nil), pkts[3]...), pkts[7]...)
+	lo := []byte{2, 0, 0, 0}
+	seg := func(seq int, payload []byte) []byte {
+		return append(append([]byte(nil), lo...), test_ipv4(6, 40000, 5000, uint32(1000 + seq), payload)...)
+	}
+	data = test_pcap(LINKTYPE_NULL,
+		seg(0, stream[:20]),
+		seg(20, stream[20:40]),
+		seg(0, stream[:20]),
+		seg(40, stream[40:]),
+	)
+	got, err = dump("test", data, options{format: "auto", codec: "auto"})
+	if err != nil || len(got) != 2 || got[0].Cmd != "SAVE_OID" || got[1].Cmd != "SAVE_DNSSOURCE" ||
+		got[0].malformed() || got[1].malformed() {
+
+		t.Errorf("unexpected tcp packets: %v %+v", err, got)
+	}
+
+	if _, err := parse_pcap(data[:len(data)-3], 0); err != ErrPcapTrunc {
+		t.Errorf("expected truncated pcap error, got %v", err)
+	}
+
+	// empty datagrams
+	empty := append(append([]byte(nil), eth...), test_ipv4(17, 5000, 6000, 0, nil)...)
+	for _, data := range [][]byte{
+		test_pcap(LINKTYPE_ETHERNET, empty),
+		test_pcap(LINKTYPE_USER0, []byte{}),
+	} {
+		for _, port := range []uint{0, 6000} {
+			got, err := dump("test", data, options{format: "auto", codec: "auto", port: port})
+			if err != nil || len(got) != 0 {
+				t.Errorf("port %v: unexpected packets from empty datagram: %v %+v", port, err, got)
+			}
+		}
+	}
+	if plausible(nil) {
+		t.Errorf("empty buffer is plausible")
+	}
+}
+
+func TestOutput(t *testing.T) {
+
+	pkts := test_packets(t, oldv1.Codec{})
+	data := append(append([]byte(nil), pkts[1]...), 1, 2, 3, 4)
+	got, err := dump("test", data, options{format: "raw", codec: "auto"})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("unexpected packets: %v %+v", err, got)
+	}
+	var b bytes.Buffer
+	print_text(&b, &got[0])
+	print_text(&b, &got[1])
+	want := `#1 test+0: oldv1 SET_AREC REQ id=2 len=72 ipver=44
+    +8    oid        7
+    +12   mark       1000
+    +16   arec       ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2
+    +44   arec       ea=10.240.0.6 ip=192.0.2.2 gw=8.8.8.8 ref=3
+#2 test+72:
+ ** 4 bytes skipped, not a V1 packet
+    0000  01020304
+`
+	if b.String() != want {
+		t.Errorf("unexpected text output:\n%v\nwant:\n%v", b.String(), want)
+	}
+	b.Reset()
+	print_json(&b, &got[0])
+	if !strings.HasPrefix(b.String(), `{"n":1,"where":"test+0","version":"oldv1","cmd":"SET_AREC","mode":"REQ","pktid":2,"pktlen":72,"ipver":"44","fields":[{"name":"oid","offset":8,"value":7}`) {
+		t.Errorf("unexpected json output: %v", b.String())
+	}
+}
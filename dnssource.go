@@ -0,0 +1,144 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"hash/fnv"
+	"sort"
+)
+
+/*
+ * A DNS source is a zone or file from which dns-agent takes mappings, saved
+ * with V1_SAVE_DNSSOURCE. Its hash identifies the content, so unchanged sources
+ * need not be sent again on reload. The request carries the mark at which the
+ * source was saved (V1_DNSSOURCE_MARK), the ACK carries the mark at which the
+ * saved source expires (V1_DNSSOURCE_XMARK), in the same place.
+ *
+ * Payload: oid (4), mark or xmark (4), hash (8), source (V1_TYPE_STRING item)
+ */
+
+type DNSSource struct {
+	OID    OID
+	Mark   Mark // when saved
+	XMark  Mark // when it expires, zero means never
+	Hash   uint64
+	Source string
+}
+
+// Returns the hash of the source data.
+func DNSSourceHash(data []byte) uint64 {
+
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// Returns the hash of the source records, independent of their order.
+func DNSSourceHashRecords(records []string) uint64 {
+
+	sorted := append([]string(nil), records...)
+	sort.Strings(sorted)
+	h := fnv.New64a()
+	for _, rec := range sorted {
+		h.Write([]byte(rec))
+		h.Write([]byte{'\n'})
+	}
+	return h.Sum64()
+}
+
+// Appends the V1_SAVE_DNSSOURCE payload, with the xmark if ack, the mark
+// otherwise.
+func (s DNSSource) AppendV1(dst []byte, ack bool) ([]byte, error) {
+
+	mark := s.Mark
+	if ack {
+		mark = s.XMark
+	}
+	start := len(dst)
+	dst = OIDMark{s.OID, mark}.AppendV1(dst)
+	dst = be.AppendUint64(dst, s.Hash)
+	dst, err := AppendV1Item(dst, V1_TYPE_STRING, s.Source)
+	if err != nil {
+		return dst[:start], err
+	}
+	return dst, nil
+}
+
+// Decodes the V1_SAVE_DNSSOURCE payload at the start of src. Returns the
+// decoded length. Safe on untrusted input.
+func DecodeDNSSource(src []byte, ack bool) (DNSSource, int, error) {
+
+	if len(src) < V1_DNSSOURCE_SOURCE {
+		return DNSSource{}, 0, ErrShortBuffer
+	}
+	om, _ := DecodeOIDMark(src)
+	s := DNSSource{OID: om.OID, Hash: be.Uint64(src[V1_DNSSOURCE_HASH:])}
+	if ack {
+		s.XMark = om.Mark // at V1_DNSSOURCE_XMARK
+	} else {
+		s.Mark = om.Mark // at V1_DNSSOURCE_MARK
+	}
+	typ, val, n, err := DecodeV1Item(src[V1_DNSSOURCE_SOURCE:])
+	if err != nil {
+		return DNSSource{}, 0, err
+	}
+	if typ != V1_TYPE_STRING {
+		return DNSSource{}, 0, ErrV1Malformed
+	}
+	s.Source = val.(string)
+	return s, V1_DNSSOURCE_SOURCE + n, nil
+}
+
+// Reports whether s is a later save of the same source than o.
+func (s DNSSource) NewerThan(o DNSSource) bool {
+	return s.OID == o.OID && s.Source == o.Source && s.Mark.After(o.Mark)
+}
+
+// Reports whether the source has expired at the owner's current mark.
+func (s DNSSource) Expired(mark Mark) bool {
+	return s.XMark != 0 && !s.XMark.After(mark)
+}
+
+// What to send after reloading sources
+type DNSSourceDiff struct {
+	Save []DNSSource // new or changed
+	Drop []DNSSource // no longer present
+}
+
+// Compares the sources held by the peer with the sources just loaded. Sources
+// are matched by OID and Source, and are changed if their hashes differ. The
+// result is sorted by OID and Source.
+func DiffDNSSources(held, loaded []DNSSource) DNSSourceDiff {
+
+	type key struct {
+		oid    OID
+		source string
+	}
+	heldm := make(map[key]DNSSource, len(held))
+	for _, s := range held {
+		heldm[key{s.OID, s.Source}] = s
+	}
+	var diff DNSSourceDiff
+	seen := make(map[key]bool, len(loaded))
+	for _, s := range loaded {
+		k := key{s.OID, s.Source}
+		seen[k] = true
+		if h, ok := heldm[k]; !ok || h.Hash != s.Hash {
+			diff.Save = append(diff.Save, s)
+		}
+	}
+	for _, s := range held {
+		if !seen[key{s.OID, s.Source}] {
+			diff.Drop = append(diff.Drop, s)
+		}
+	}
+	for _, ss := range [][]DNSSource{diff.Save, diff.Drop} {
+		sort.Slice(ss, func(i, j int) bool {
+			if ss[i].OID != ss[j].OID {
+				return ss[i].OID < ss[j].OID
+			}
+			return ss[i].Source < ss[j].Source
+		})
+	}
+	return diff
+}
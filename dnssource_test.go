@@ -0,0 +1,70 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDNSSource(t *testing.T) {
+
+	s := DNSSource{OID: 7, Mark: 100, XMark: 200, Hash: DNSSourceHash([]byte("zone data")), Source: "example.com"}
+	for _, ack := range []bool{false, true} {
+		enc, err := s.AppendV1(nil, ack)
+		if err != nil || len(enc) % 4 != 0 {
+			t.Fatalf("unexpected encoding % x %v", enc, err)
+		}
+		x, n, err := DecodeDNSSource(append(enc, 0xff), ack)
+		expected := s
+		if ack {
+			expected.Mark = 0
+		} else {
+			expected.XMark = 0
+		}
+		if err != nil || n != len(enc) || x != expected {
+			t.Errorf("ack %v: expected %+v, got %+v %v %v", ack, expected, x, n, err)
+		}
+		if _, _, err := DecodeDNSSource(enc[:len(enc)-4], ack); err == nil {
+			t.Errorf("ack %v: expected error for truncated payload", ack)
+		}
+	}
+
+	if DNSSourceHashRecords([]string{"a", "b"}) != DNSSourceHashRecords([]string{"b", "a"}) ||
+		DNSSourceHashRecords([]string{"ab"}) == DNSSourceHashRecords([]string{"a", "b"}) {
+		t.Errorf("unexpected record hashes")
+	}
+
+	newer := s
+	newer.Mark = 101
+	if !newer.NewerThan(s) || s.NewerThan(newer) || s.NewerThan(s) {
+		t.Errorf("unexpected NewerThan")
+	}
+	wrapped := DNSSource{OID: 7, Mark: 5, Source: "example.com"}
+	if !wrapped.NewerThan(DNSSource{OID: 7, Mark: 0xfffffff0, Source: "example.com"}) {
+		t.Errorf("expected wrapped mark to be newer")
+	}
+	if s.Expired(199) || !s.Expired(200) || !s.Expired(300) || (DNSSource{}).Expired(300) {
+		t.Errorf("unexpected Expired")
+	}
+
+	held := []DNSSource{
+		{OID: 1, Hash: 1, Source: "a"},
+		{OID: 1, Hash: 2, Source: "b"},
+		{OID: 1, Hash: 3, Source: "c"},
+	}
+	loaded := []DNSSource{
+		{OID: 1, Hash: 9, Source: "d"},
+		{OID: 1, Hash: 4, Source: "b"},
+		{OID: 1, Hash: 1, Source: "a"},
+		{OID: 2, Hash: 3, Source: "c"},
+	}
+	diff := DiffDNSSources(held, loaded)
+	expected := DNSSourceDiff{
+		Save: []DNSSource{loaded[1], loaded[0], loaded[3]},
+		Drop: []DNSSource{held[2]},
+	}
+	if !reflect.DeepEqual(diff, expected) {
+		t.Errorf("expected %+v, got %+v", expected, diff)
+	}
+}
@@ -0,0 +1,497 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+/*
+ * EAPool assigns encoding addresses (AddrRec.EA) from local pools to remote
+ * IpRefs. Each IpRef holds at most one lease per IP version. Leases carry a
+ * mark and an expiry time, and are ordered by use. When a pool is exhausted,
+ * the least recently used dynamic lease is reclaimed. Static assignments are
+ * never reclaimed nor expired. EAPool is not safe for concurrent use.
+ */
+
+type EAStrategy int
+
+const ( // ea allocation strategies
+
+	EA_ALLOC_SEQUENTIAL EAStrategy = iota // next free address after the previous one
+	EA_ALLOC_RANDOM                       // random free address
+	EA_ALLOC_HASH                         // derived from the IpRef, stable across restarts
+)
+
+// Allocation probes at most this many addresses of each pool for a free one.
+// Pools this size or smaller are searched completely. In larger pools, eg. IPv6
+// /64, an allocation which finds no free address within the limit reclaims the
+// least recently used lease, as if the pools were exhausted.
+const EA_SCAN_LIMIT = 1 << 16
+
+var (
+	ErrNoEAPool        = errors.New("no encoding address pool for IP version")
+	ErrEAPoolExhausted = errors.New("encoding address pool exhausted")
+	ErrEAInUse         = errors.New("encoding address already assigned")
+)
+
+type EALease struct {
+	EA     IP
+	IpRef  IpRef
+	Mark   uint32
+	Expiry time.Time // zero means never
+	Static bool
+}
+
+type EAPool struct {
+	strategy EAStrategy
+	pools    []IPPrefix
+	cursors  []Uint128 // per pool, offset of the next sequential candidate
+	excluded IPSetBuilder
+	excl     IPSet // snapshot of excluded, taken when next needed if stale
+	stale    bool
+	leases   map[IP]*list.Element
+	iprefs   map[ipref_key]*list.Element
+	lru      list.List // *EALease, least recently used first; static leases aren't on it
+}
+
+type ipref_key struct {
+	ipref IpRef
+	ipver int // of the ea
+}
+
+func lease_key(lease *EALease) ipref_key {
+	return ipref_key{lease.IpRef, lease.EA.Ver()}
+}
+
+func NewEAPool(strategy EAStrategy, pools ...IPPrefix) *EAPool {
+
+	p := &EAPool{
+		strategy: strategy,
+		leases:   make(map[IP]*list.Element),
+		iprefs:   make(map[ipref_key]*list.Element),
+	}
+	for _, pool := range pools {
+		p.AddPool(pool)
+	}
+	return p
+}
+
+// Adds a pool. For IPv4 pools larger than /31, the network and broadcast
+// addresses are excluded.
+func (p *EAPool) AddPool(pool IPPrefix) {
+
+	p.pools = append(p.pools, pool)
+	p.cursors = append(p.cursors, Uint128{})
+	if pool.Addr().Is4() && pool.Bits() < 31 {
+		p.Exclude(pool.Addr())
+		p.Exclude(pool.Broadcast())
+	}
+}
+
+func (p *EAPool) Pools() []IPPrefix {
+	return append([]IPPrefix(nil), p.pools...)
+}
+
+// Excludes the address from allocation. Existing leases are not affected.
+func (p *EAPool) Exclude(ea IP) {
+	p.ExcludeRange(IPRange{ea, ea})
+}
+
+func (p *EAPool) ExcludePrefix(prefix IPPrefix) {
+	p.ExcludeRange(prefix.Range())
+}
+
+func (p *EAPool) ExcludeRange(r IPRange) {
+
+	p.excluded.AddRange(r)
+	p.stale = true
+}
+
+func (p *EAPool) sync_excl() {
+
+	if p.stale {
+		p.excl = p.excluded.IPSet()
+		p.stale = false
+	}
+}
+
+// Assigns the address to the IpRef permanently, replacing any lease the IpRef
+// holds of the same IP version. The address need not be in any pool.
+func (p *EAPool) AddStatic(ea IP, ipref IpRef, mark uint32) error {
+
+	if ea.IsZero() || ipref.IP.IsZero() {
+		return ErrUninitialized
+	}
+	if e, ok := p.leases[ea]; ok && e.Value.(*EALease).IpRef != ipref {
+		return ErrEAInUse
+	}
+	key := ipref_key{ipref, ea.Ver()}
+	if e, ok := p.iprefs[key]; ok {
+		p.remove(e)
+	}
+	lease := &EALease{EA: ea, IpRef: ipref, Mark: mark, Static: true}
+	e := &list.Element{Value: lease}
+	p.leases[ea] = e
+	p.iprefs[key] = e
+	return nil
+}
+
+// Returns a lease of an address of the given version for the IpRef. If the
+// IpRef already holds one, it is renewed with the new mark and expiry instead.
+// Leases of the other version are not affected.
+func (p *EAPool) Allocate(ipver int, ipref IpRef, mark uint32, expiry time.Time) (EALease, error) {
+
+	if ipref.IP.IsZero() {
+		return EALease{}, ErrUninitialized
+	}
+	key := ipref_key{ipref, ipver}
+	if e, ok := p.iprefs[key]; ok {
+		lease := e.Value.(*EALease)
+		if !lease.Static {
+			lease.Mark = mark
+			lease.Expiry = expiry
+			p.lru.MoveToBack(e)
+		}
+		return *lease, nil
+	}
+	p.sync_excl()
+	ea, err := p.find_free(ipver, ipref)
+	if err == ErrEAPoolExhausted {
+		ea, err = p.reclaim(ipver)
+	}
+	if err != nil {
+		return EALease{}, err
+	}
+	lease := &EALease{EA: ea, IpRef: ipref, Mark: mark, Expiry: expiry}
+	e := p.lru.PushBack(lease)
+	p.leases[ea] = e
+	p.iprefs[key] = e
+	return *lease, nil
+}
+
+func (p *EAPool) find_free(ipver int, ipref IpRef) (IP, error) {
+
+	var candidates []int
+	for i, pool := range p.pools {
+		if pool.Addr().Ver() == ipver {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return IP{}, ErrNoEAPool
+	}
+	first := 0
+	var start Uint128
+	switch p.strategy {
+	case EA_ALLOC_RANDOM:
+		first = rand.Intn(len(candidates))
+		start = Uint128{rand.Uint64(), rand.Uint64()}
+	case EA_ALLOC_HASH:
+		h := fnv.New128a()
+		h.Write(ipref.IP.AsSlice())
+		h.Write(ipref.Ref.AsSliceBE())
+		start = Uint128FromBytesBE(h.Sum(nil))
+		first = int(start.H % uint64(len(candidates)))
+	}
+	for k := range candidates {
+		i := candidates[(first + k) % len(candidates)]
+		offset := start
+		if p.strategy == EA_ALLOC_SEQUENTIAL {
+			offset = p.cursors[i]
+		}
+		budget := EA_SCAN_LIMIT
+		if ea, ok := p.probe(i, offset, &budget); ok {
+			if p.strategy == EA_ALLOC_SEQUENTIAL {
+				p.cursors[i] = ea.AsUint128Cast().Sub(p.pools[i].Addr().AsUint128Cast()).Add(UINT128_1)
+			}
+			return ea, nil
+		}
+	}
+	return IP{}, ErrEAPoolExhausted
+}
+
+// Returns the first free address in pool i at or after the offset, wrapping
+// around at the end of the pool, within the budget of probes.
+func (p *EAPool) probe(i int, offset Uint128, budget *int) (IP, bool) {
+
+	pool := p.pools[i]
+	hostmask := pool.HostMask().AsUint128Cast()
+	offset = offset.And(hostmask)
+	if ea, ok := p.scan(pool, offset, hostmask, budget); ok {
+		return ea, true
+	}
+	if offset.IsZero() {
+		return IP{}, false
+	}
+	return p.scan(pool, UINT128_0, offset.Sub(UINT128_1), budget)
+}
+
+// Returns the first free address in the pool at offsets lo through hi. Each
+// address probed, or excluded range skipped, takes one from the budget.
+func (p *EAPool) scan(pool IPPrefix, lo, hi Uint128, budget *int) (IP, bool) {
+
+	base := pool.Addr().AsUint128Cast()
+	ipver := pool.Addr().Ver()
+	for off := lo; *budget > 0; off = off.Add(UINT128_1) {
+		*budget--
+		ea := ip_from_uint128(ipver, base.Or(off))
+		if r, ok := p.excl.range_containing(ea); ok {
+			// skip to the end of the excluded range
+			off = r.to.AsUint128Cast().Sub(base)
+		} else if _, ok := p.leases[ea]; !ok {
+			return ea, true
+		}
+		if off.Cmp(hi) >= 0 {
+			return IP{}, false
+		}
+	}
+	return IP{}, false
+}
+
+// Takes the address of the least recently used dynamic lease of the version.
+func (p *EAPool) reclaim(ipver int) (IP, error) {
+
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		lease := e.Value.(*EALease)
+		if lease.EA.Ver() == ipver && p.in_pool(lease.EA) {
+			p.remove(e)
+			return lease.EA, nil
+		}
+	}
+	return IP{}, ErrEAPoolExhausted
+}
+
+func (p *EAPool) in_pool(ea IP) bool {
+	return IPPrefixesContain(p.pools, ea) && !p.excl.Contains(ea)
+}
+
+// Marks the lease of the address as recently used.
+func (p *EAPool) Touch(ea IP) {
+
+	if e, ok := p.leases[ea]; ok && !e.Value.(*EALease).Static {
+		p.lru.MoveToBack(e)
+	}
+}
+
+func (p *EAPool) Lookup(ea IP) (EALease, bool) {
+
+	if e, ok := p.leases[ea]; ok {
+		return *e.Value.(*EALease), true
+	}
+	return EALease{}, false
+}
+
+// Returns the lease of an address of the given version held by the IpRef.
+func (p *EAPool) LookupIpRef(ipver int, ipref IpRef) (EALease, bool) {
+
+	if e, ok := p.iprefs[ipref_key{ipref, ipver}]; ok {
+		return *e.Value.(*EALease), true
+	}
+	return EALease{}, false
+}
+
+// Releases the lease, static or dynamic, of the address. Returns whether there
+// was one.
+func (p *EAPool) Release(ea IP) bool {
+
+	e, ok := p.leases[ea]
+	if ok {
+		p.remove(e)
+	}
+	return ok
+}
+
+func (p *EAPool) remove(e *list.Element) {
+
+	lease := e.Value.(*EALease)
+	delete(p.leases, lease.EA)
+	delete(p.iprefs, lease_key(lease))
+	if !lease.Static {
+		p.lru.Remove(e)
+	}
+}
+
+// Releases all dynamic leases which expired before now, and returns them.
+func (p *EAPool) Expire(now time.Time) []EALease {
+
+	var expired []EALease
+	for e := p.lru.Front(); e != nil; {
+		next := e.Next()
+		lease := e.Value.(*EALease)
+		if !lease.Expiry.IsZero() && lease.Expiry.Before(now) {
+			expired = append(expired, *lease)
+			p.remove(e)
+		}
+		e = next
+	}
+	return expired
+}
+
+func (p *EAPool) Len() int {
+	return len(p.leases)
+}
+
+// Returns all leases, static ones first, then dynamic ones from the least to
+// the most recently used.
+func (p *EAPool) Leases() []EALease {
+
+	leases := make([]EALease, 0, len(p.leases))
+	for _, e := range p.leases {
+		if lease := e.Value.(*EALease); lease.Static {
+			leases = append(leases, *lease)
+		}
+	}
+	sort.Slice(leases, func(i, j int) bool {
+		return leases[i].EA.Compare(leases[j].EA) < 0
+	})
+	for e := p.lru.Front(); e != nil; e = e.Next() {
+		leases = append(leases, *e.Value.(*EALease))
+	}
+	return leases
+}
+
+// Serializable state of an EAPool, eg. with encoding/json
+type EAPoolState struct {
+	Strategy EAStrategy
+	Pools    []IPPrefix
+	Excluded []IPPrefix
+	Leases   []EALease // in the order returned by Leases()
+}
+
+// JSON form of EAPoolState, with addresses, prefixes and refs as strings
+type ea_pool_state_json struct {
+	Strategy EAStrategy      `json:"strategy"`
+	Pools    []string        `json:"pools"`
+	Excluded []string        `json:"excluded"`
+	Leases   []ea_lease_json `json:"leases"`
+}
+
+type ea_lease_json struct {
+	EA     string    `json:"ea"`
+	IP     string    `json:"ip"`
+	Ref    string    `json:"ref"`
+	Mark   uint32    `json:"mark"`
+	Expiry time.Time `json:"expiry"` // zero means never
+	Static bool      `json:"static,omitempty"`
+}
+
+func (state EAPoolState) MarshalJSON() ([]byte, error) {
+
+	js := ea_pool_state_json{
+		Strategy: state.Strategy,
+		Pools:    make([]string, 0, len(state.Pools)),
+		Excluded: make([]string, 0, len(state.Excluded)),
+		Leases:   make([]ea_lease_json, 0, len(state.Leases)),
+	}
+	for _, prefix := range state.Pools {
+		js.Pools = append(js.Pools, prefix.String())
+	}
+	for _, prefix := range state.Excluded {
+		js.Excluded = append(js.Excluded, prefix.String())
+	}
+	for _, lease := range state.Leases {
+		if lease.EA.IsZero() || lease.IpRef.IP.IsZero() {
+			return nil, ErrUninitialized
+		}
+		js.Leases = append(js.Leases, ea_lease_json{
+			EA:     lease.EA.String(),
+			IP:     lease.IpRef.IP.String(),
+			Ref:    lease.IpRef.Ref.String(),
+			Mark:   lease.Mark,
+			Expiry: lease.Expiry,
+			Static: lease.Static,
+		})
+	}
+	return json.Marshal(js)
+}
+
+func (state *EAPoolState) UnmarshalJSON(data []byte) error {
+
+	var js ea_pool_state_json
+	if err := json.Unmarshal(data, &js); err != nil {
+		return err
+	}
+	x := EAPoolState{Strategy: js.Strategy}
+	for _, field := range []struct {
+		dst  *[]IPPrefix
+		strs []string
+	}{
+		{&x.Pools, js.Pools},
+		{&x.Excluded, js.Excluded},
+	} {
+		for _, str := range field.strs {
+			prefix, err := ParseIPPrefix(str)
+			if err != nil {
+				return err
+			}
+			*field.dst = append(*field.dst, prefix)
+		}
+	}
+	for _, jl := range js.Leases {
+		ea, err := ParseIP(jl.EA)
+		if err != nil {
+			return err
+		}
+		ip, err := ParseIP(jl.IP)
+		if err != nil {
+			return err
+		}
+		ref, err := ParseRef(jl.Ref)
+		if err != nil {
+			return err
+		}
+		x.Leases = append(x.Leases, EALease{ea, IpRef{ip, ref}, jl.Mark, jl.Expiry, jl.Static})
+	}
+	*state = x
+	return nil
+}
+
+func (p *EAPool) State() EAPoolState {
+
+	p.sync_excl()
+	return EAPoolState{
+		Strategy: p.strategy,
+		Pools:    p.Pools(),
+		Excluded: p.excl.Prefixes(),
+		Leases:   p.Leases(),
+	}
+}
+
+func EAPoolFromState(state EAPoolState) (*EAPool, error) {
+
+	p := NewEAPool(state.Strategy)
+	p.pools = append(p.pools, state.Pools...)
+	p.cursors = make([]Uint128, len(p.pools))
+	for _, prefix := range state.Excluded {
+		p.excluded.AddPrefix(prefix)
+	}
+	p.excl = p.excluded.IPSet()
+	for _, lease := range state.Leases {
+		if lease.EA.IsZero() || lease.IpRef.IP.IsZero() {
+			return nil, ErrUninitialized
+		}
+		if _, ok := p.leases[lease.EA]; ok {
+			return nil, ErrEAInUse
+		}
+		if _, ok := p.iprefs[lease_key(&lease)]; ok {
+			return nil, errors.New("IpRef holds more than one lease of the same IP version")
+		}
+		x := lease
+		var e *list.Element
+		if x.Static {
+			e = &list.Element{Value: &x}
+		} else {
+			e = p.lru.PushBack(&x)
+		}
+		p.leases[x.EA] = e
+		p.iprefs[lease_key(&x)] = e
+	}
+	return p, nil
+}
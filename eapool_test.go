@@ -0,0 +1,149 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEAPool(t *testing.T) {
+
+	ipref := func(i int) IpRef {
+		return IpRef{MustParseIP("192.0.2.1"), Ref(Uint128FromUint64(uint64(i)))}
+	}
+	pool := NewEAPool(EA_ALLOC_SEQUENTIAL, MustParseIPPrefix("10.240.0.0/29"))
+	pool.Exclude(MustParseIP("10.240.0.2"))
+	if err := pool.AddStatic(MustParseIP("10.240.0.3"), ipref(100), 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// .0 and .7 are network and broadcast, .2 is excluded, .3 is static
+	expiry := time.Unix(1000, 0)
+	expected := []string{"10.240.0.1", "10.240.0.4", "10.240.0.5", "10.240.0.6"}
+	for i, ea := range expected {
+		lease, err := pool.Allocate(4, ipref(i), 7, expiry)
+		if err != nil || lease.EA != MustParseIP(ea) {
+			t.Fatalf("allocation %v: expected %v, got %v %v", i, ea, lease.EA, err)
+		}
+	}
+	if lease, _ := pool.Allocate(4, ipref(2), 8, expiry); lease.EA != MustParseIP("10.240.0.5") ||
+		lease.Mark != 8 {
+		t.Errorf("renewal returned %+v", lease)
+	}
+	pool.Touch(MustParseIP("10.240.0.1"))
+
+	// exhausted: the least recently used lease is .4 (ipref 1)
+	lease, err := pool.Allocate(4, ipref(10), 9, expiry)
+	if err != nil || lease.EA != MustParseIP("10.240.0.4") {
+		t.Errorf("expected to reclaim 10.240.0.4, got %v %v", lease.EA, err)
+	}
+	if _, ok := pool.LookupIpRef(4, ipref(1)); ok {
+		t.Errorf("reclaimed lease still present")
+	}
+	if _, err := pool.Allocate(6, ipref(1), 9, expiry); err != ErrNoEAPool {
+		t.Errorf("expected ErrNoEAPool, got %v", err)
+	}
+
+	if !pool.Release(MustParseIP("10.240.0.6")) || pool.Len() != 4 {
+		t.Errorf("release failed")
+	}
+	expired := pool.Expire(time.Unix(2000, 0))
+	if len(expired) != 3 || pool.Len() != 1 {
+		t.Errorf("expected 3 expired leases, got %v", expired)
+	}
+
+	data, err := json.Marshal(pool.State())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	if !strings.Contains(string(data), `"ea":"10.240.0.3"`) {
+		t.Errorf("unexpected JSON state: %s", data)
+	}
+	var state EAPoolState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("unmarshal %s: %v", data, err)
+	}
+	restored, err := EAPoolFromState(state)
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if l, ok := restored.Lookup(MustParseIP("10.240.0.3")); !ok || !l.Static || l.IpRef != ipref(100) {
+		t.Errorf("static lease not restored: %+v", l)
+	}
+	if lease, _ := restored.Allocate(4, ipref(20), 1, expiry); lease.EA != MustParseIP("10.240.0.1") {
+		t.Errorf("restored pool allocated %v", lease.EA)
+	}
+}
+
+func TestEAPoolVersions(t *testing.T) {
+
+	pool := NewEAPool(EA_ALLOC_SEQUENTIAL, MustParseIPPrefix("10.240.0.0/29"), MustParseIPPrefix("fd00::/120"))
+	ipref := MustParseIpRef("192.0.2.1 + 1-2")
+	if err := pool.AddStatic(MustParseIP("10.240.1.1"), ipref, 1); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	lease6, err := pool.Allocate(6, ipref, 2, time.Time{})
+	if err != nil || !lease6.EA.Is6() {
+		t.Fatalf("unexpected IPv6 lease: %+v %v", lease6, err)
+	}
+	if l, ok := pool.LookupIpRef(4, ipref); !ok || !l.Static || l.EA != MustParseIP("10.240.1.1") {
+		t.Errorf("static IPv4 lease lost after IPv6 allocation: %+v %v", l, ok)
+	}
+	if l, ok := pool.LookupIpRef(6, ipref); !ok || l.EA != lease6.EA {
+		t.Errorf("IPv6 lease not found: %+v %v", l, ok)
+	}
+	if pool.Len() != 2 {
+		t.Errorf("expected 2 leases, got %v", pool.Len())
+	}
+	restored, err := EAPoolFromState(pool.State())
+	if err != nil || restored.Len() != 2 {
+		t.Errorf("unexpected restored pool: %v", err)
+	}
+
+	// exclusions take effect on the next allocation
+	for i := 1; i < 7; i++ {
+		pool.Exclude(IPFromUint32(0x0af00000 + uint32(i)))
+	}
+	if _, err := pool.Allocate(4, MustParseIpRef("192.0.2.2 + 3"), 0, time.Time{}); err != ErrEAPoolExhausted {
+		t.Errorf("expected ErrEAPoolExhausted, got %v", err)
+	}
+}
+
+func TestEAPoolScanLimit(t *testing.T) {
+
+	pool := NewEAPool(EA_ALLOC_SEQUENTIAL, MustParseIPPrefix("fd00::/64"))
+	ipref := func(i int) IpRef {
+		return IpRef{MustParseIP("192.0.2.1"), Ref(Uint128FromUint64(uint64(i + 1)))}
+	}
+	var first EALease
+	for i := 0; i < EA_SCAN_LIMIT; i++ {
+		lease, err := pool.Allocate(6, ipref(i), 0, time.Time{})
+		if err != nil {
+			t.Fatalf("allocation %v: %v", i, err)
+		}
+		if i == 0 {
+			first = lease
+		}
+	}
+	// the free addresses lie beyond the limit from the start of the pool
+	pool.cursors[0] = Uint128{}
+	lease, err := pool.Allocate(6, ipref(EA_SCAN_LIMIT), 0, time.Time{})
+	if err != nil || lease.EA != first.EA {
+		t.Errorf("expected the least recently used %v, got %v %v", first.EA, lease.EA, err)
+	}
+}
+
+func TestEAPoolHash(t *testing.T) {
+
+	a := NewEAPool(EA_ALLOC_HASH, MustParseIPPrefix("fd00::/64"))
+	b := NewEAPool(EA_ALLOC_HASH, MustParseIPPrefix("fd00::/64"))
+	ipref := MustParseIpRef("2001:db8::1 + 1-2")
+	la, _ := a.Allocate(6, ipref, 0, time.Time{})
+	lb, _ := b.Allocate(6, ipref, 0, time.Time{})
+	if la.EA != lb.EA || !MustParseIPPrefix("fd00::/64").Contains(la.EA) {
+		t.Errorf("hash allocation not stable: %v %v", la.EA, lb.EA)
+	}
+}
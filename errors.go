@@ -0,0 +1,46 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "errors"
+
+/*
+ * Most functions in this package panic on invalid arguments - uninitialized
+ * IPs, IPs of different versions, invalid lengths. That's appropriate for
+ * values produced by the program itself, but not for values derived from
+ * untrusted input, such as packets received from a peer. Except as noted below,
+ * every panicking function has a non-panicking counterpart which reports the
+ * problem as one of the errors below:
+ *
+ *   - Try<Method>   for accessors and conversions, eg. IP.TryAsSlice()
+ *   - <Method>Err   for operations and codecs, eg. IP.CompareErr(),
+ *                   newv1.AddrRecEncodeErr()
+ *   - <Func>Checked for constructors, eg. IPFromSliceChecked(),
+ *                   RefPrefixFromChecked()
+ *
+ * Safe to use on untrusted input as is: the Parse* functions, IP.IsZero(),
+ * IP.String(), IPPrefix.Contains(), IPPrefix.Subnets(), IPRange and IPSet
+ * methods (including IPSet.Complement() with any ipver) on values returned by
+ * Parse* or checked constructors, IPPrefixTable lookups, IP.ReverseName(),
+ * IPPrefix.ReverseZones(), IPPort methods and IPPortFrom*(),
+ * ParseReverseName(), AddrRec.CheckEncodable(), and
+ * newv1.AddrRecCheck/AddrRecDecode().
+ *
+ * The exceptions, without counterparts, are the codecs' AddrRecSlices(), which
+ * slice a buffer already checked with AddrRecCheck(). The Must* functions are
+ * for constants and always panic on invalid input.
+ */
+
+var (
+	ErrUninitialized     = errors.New("uninitialized")
+	ErrIPVersionMismatch = errors.New("IP addresses are different versions")
+	ErrInvalidIPLength   = errors.New("invalid IP address length")
+	ErrNotIPv4           = errors.New("expected IPv4 address")
+	ErrNotIPv6           = errors.New("expected IPv6 address")
+	ErrInvalidPrefixLen  = errors.New("invalid prefix length")
+	ErrInvalidRange      = errors.New("invalid IP range")
+	ErrNonContiguousMask = errors.New("non-contiguous netmask")
+	ErrIndexOutOfRange   = errors.New("index out of range")
+	ErrIPOverflow        = errors.New("IP address arithmetic overflows its address family")
+	ErrShortBuffer       = errors.New("buffer too short")
+)
@@ -21,12 +21,15 @@ func (ip IP) IsZeroAddr() bool {
 	if ip.IsZero() {
 		panic("uninitialized")
 	}
-	s := ip.AsSlice()
-	var b byte
-	for i := 0; i < len(s); i++ {
-		b |= s[i]
+	return ip.AsUint128Cast().IsZero()
+}
+
+func (ip IP) TryIsZeroAddr() (bool, error) {
+
+	if ip.IsZero() {
+		return false, ErrUninitialized
 	}
-	return b == 0
+	return ip.IsZeroAddr(), nil
 }
 
 func (ip IP) String() string {
@@ -68,6 +71,14 @@ func IPFromSlice(ip []byte) IP {
 	return IP(addr)
 }
 
+func IPFromSliceChecked(ip []byte) (IP, error) {
+
+	if len(ip) != 4 && len(ip) != 16 {
+		return IP{}, ErrInvalidIPLength
+	}
+	return IPFromSlice(ip), nil
+}
+
 func IPFromUint32(ip uint32) IP {
 
 	var ipb [4]byte
@@ -82,6 +93,15 @@ func IPFromUint128(ip Uint128) IP {
 	return IP(netip.AddrFrom16(ipb))
 }
 
+// Inverse of AsUint128Cast
+func ip_from_uint128(ipver int, x Uint128) IP {
+
+	if ipver == 4 {
+		return IPFromUint32(x.Uint32())
+	}
+	return IPFromUint128(x)
+}
+
 func (ip IP) AsSlice() []byte {
 
 	if ip.IsZero() {
@@ -90,6 +110,14 @@ func (ip IP) AsSlice() []byte {
 	return netip.Addr(ip).AsSlice()
 }
 
+func (ip IP) TryAsSlice() ([]byte, error) {
+
+	if ip.IsZero() {
+		return nil, ErrUninitialized
+	}
+	return ip.AsSlice(), nil
+}
+
 func (ip IP) AsSlice4() []byte {
 
 	if !ip.Is4() {
@@ -98,6 +126,17 @@ func (ip IP) AsSlice4() []byte {
 	return ip.AsSlice()
 }
 
+func (ip IP) TryAsSlice4() ([]byte, error) {
+
+	if ip.IsZero() {
+		return nil, ErrUninitialized
+	}
+	if !ip.Is4() {
+		return nil, ErrNotIPv4
+	}
+	return ip.AsSlice(), nil
+}
+
 func (ip IP) AsSlice6() []byte {
 
 	if !ip.Is6() {
@@ -106,6 +145,17 @@ func (ip IP) AsSlice6() []byte {
 	return ip.AsSlice()
 }
 
+func (ip IP) TryAsSlice6() ([]byte, error) {
+
+	if ip.IsZero() {
+		return nil, ErrUninitialized
+	}
+	if !ip.Is6() {
+		return nil, ErrNotIPv6
+	}
+	return ip.AsSlice(), nil
+}
+
 func (ip IP) AsUint32() uint32 {
 
 	if ip.IsZero() {
@@ -115,6 +165,17 @@ func (ip IP) AsUint32() uint32 {
 	return uint32(be.Uint32(ipb[:]))
 }
 
+func (ip IP) TryAsUint32() (uint32, error) {
+
+	if ip.IsZero() {
+		return 0, ErrUninitialized
+	}
+	if !ip.Is4() {
+		return 0, ErrNotIPv4
+	}
+	return ip.AsUint32(), nil
+}
+
 func (ip IP) AsUint128() Uint128 {
 
 	if ip.IsZero() {
@@ -124,6 +185,14 @@ func (ip IP) AsUint128() Uint128 {
 	return Uint128FromBytesBE(ipb[:])
 }
 
+func (ip IP) TryAsUint128() (Uint128, error) {
+
+	if ip.IsZero() {
+		return Uint128{}, ErrUninitialized
+	}
+	return ip.AsUint128(), nil
+}
+
 func (ip IP) AsUint128Cast() Uint128 {
 
 	if ip.IsZero() {
@@ -138,29 +207,39 @@ func (ip IP) AsUint128Cast() Uint128 {
 	}
 }
 
+func (ip IP) TryAsUint128Cast() (Uint128, error) {
+
+	if ip.IsZero() {
+		return Uint128{}, ErrUninitialized
+	}
+	return ip.AsUint128Cast(), nil
+}
+
+// Returns the socket address with port 0 and no scope ID. Use
+// IPPort.AsUnixSockaddr for a port and zone.
 func (ip IP) AsUnixSockaddr() unix.Sockaddr {
 
-	if ip.Is4() {
-		var addr unix.SockaddrInet4
-		copy(addr.Addr[:], ip.AsSlice())
-		return &addr
-	} else {
-		var addr unix.SockaddrInet6
-		copy(addr.Addr[:], ip.AsSlice())
-		return &addr
+	addr, err := ip.TryAsUnixSockaddr()
+	if err != nil {
+		panic(err.Error())
 	}
+	return addr
+}
+
+func (ip IP) TryAsUnixSockaddr() (unix.Sockaddr, error) {
+	return IPPort{IP: ip}.AsUnixSockaddr()
 }
 
+// Returns the IP of an IPv4 or IPv6 socket address, or a zero IP for other
+// families. The port and scope ID are dropped. Use IPPortFromUnixSockaddr to
+// keep them, and to have other families reported as errors.
 func IPFromUnixSockaddr(addr unix.Sockaddr) IP {
 
-	switch a := addr.(type) {
-	case *unix.SockaddrInet4:
-		return IPFromSlice(a.Addr[:])
-	case *unix.SockaddrInet6:
-		return IPFromSlice(a.Addr[:])
-	default:
+	ipp, err := IPPortFromUnixSockaddr(addr)
+	if err != nil {
 		return IP{}
 	}
+	return ipp.IP
 }
 
 func (ip IP) Is4() bool {
@@ -226,6 +305,16 @@ func (ip IP) Ver() int {
 	}
 }
 
+// Returns the IP version, or an error if the IP is uninitialized. Use instead of
+// Is4(), Is6(), Len() and Ver() on untrusted values.
+func (ip IP) TryVer() (int, error) {
+
+	if ip.IsZero() {
+		return 0, ErrUninitialized
+	}
+	return ip.Ver(), nil
+}
+
 func IPLenToVer(l int) int {
 
 	switch l {
@@ -252,77 +341,160 @@ func IPVerToLen(ver int) int {
 
 func (ip IP) ByteFromEnd(i int) byte {
 
-	bs := ip.AsSlice()
-	return bs[len(bs) - i - 1]
+	if i < 0 || i >= ip.Len() {
+		panic("index out of range")
+	}
+	bs := netip.Addr(ip).As16()
+	return bs[15 - i]
 }
 
-func (a IP) Or(b IP) IP {
+func (ip IP) TryByteFromEnd(i int) (byte, error) {
 
-	as := a.AsSlice()
-	bs := b.AsSlice()
-	if len(as) != len(bs) {
-		panic("IP addresses are different length")
+	if ip.IsZero() {
+		return 0, ErrUninitialized
 	}
-	var cs [16]byte
-	for i := 0; i < len(as); i++ {
-		cs[i] = as[i] | bs[i]
+	if i < 0 || i >= ip.Len() {
+		return 0, ErrIndexOutOfRange
 	}
-	return IPFromSlice(cs[:len(as)])
+	return ip.ByteFromEnd(i), nil
 }
 
-func (a IP) And(b IP) IP {
+func (a IP) Or(b IP) IP {
 
-	as := a.AsSlice()
-	bs := b.AsSlice()
-	if len(as) != len(bs) {
-		panic("IP addresses are different length")
+	ver := same_ver(a, b)
+	return ip_from_uint128(ver, a.AsUint128Cast().Or(b.AsUint128Cast()))
+}
+
+func (a IP) OrErr(b IP) (IP, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return IP{}, err
 	}
-	var cs [16]byte
-	for i := 0; i < len(as); i++ {
-		cs[i] = as[i] & bs[i]
+	return a.Or(b), nil
+}
+
+func (a IP) And(b IP) IP {
+
+	ver := same_ver(a, b)
+	return ip_from_uint128(ver, a.AsUint128Cast().And(b.AsUint128Cast()))
+}
+
+func (a IP) AndErr(b IP) (IP, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return IP{}, err
 	}
-	return IPFromSlice(cs[:len(as)])
+	return a.And(b), nil
 }
 
 func (a IP) XOr(b IP) IP {
 
-	as := a.AsSlice()
-	bs := b.AsSlice()
-	if len(as) != len(bs) {
-		panic("IP addresses are different length")
-	}
-	var cs [16]byte
-	for i := 0; i < len(as); i++ {
-		cs[i] = as[i] ^ bs[i]
+	ver := same_ver(a, b)
+	return ip_from_uint128(ver, a.AsUint128Cast().Xor(b.AsUint128Cast()))
+}
+
+func (a IP) XOrErr(b IP) (IP, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return IP{}, err
 	}
-	return IPFromSlice(cs[:len(as)])
+	return a.XOr(b), nil
 }
 
 func (a IP) Not() IP {
+	return ip_from_uint128(a.Ver(), a.AsUint128Cast().Compl())
+}
 
-	as := a.AsSlice()
-	var bs [16]byte
-	for i := 0; i < len(as); i++ {
-		bs[i] = ^as[i]
+func (a IP) NotErr() (IP, error) {
+
+	if a.IsZero() {
+		return IP{}, ErrUninitialized
 	}
-	return IPFromSlice(bs[:len(as)])
+	return a.Not(), nil
 }
 
+// Carry out of the most significant bit is discarded.
 func (a IP) Add(b IP) IP {
 
-	as := a.AsSlice()
-	bs := b.AsSlice()
-	if len(as) != len(bs) {
+	ver := same_ver(a, b)
+	return ip_from_uint128(ver, a.AsUint128Cast().Add(b.AsUint128Cast()))
+}
+
+// Returns the version of a and b, which must be the same.
+func same_ver(a, b IP) int {
+
+	ver := a.Ver()
+	if b.Ver() != ver {
 		panic("IP addresses are different length")
 	}
-	var cs [16]byte
-	var carry uint16
-	for i := len(as) - 1; i >= 0; i-- {
-		carry += uint16(as[i]) + uint16(bs[i])
-		cs[i] = uint8(carry)
-		carry >>= 8
+	return ver
+}
+
+func (a IP) AddErr(b IP) (IP, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return IP{}, err
+	}
+	return a.Add(b), nil
+}
+
+// Returns the address following ip, or ErrIPOverflow if ip is the last address
+// of its family.
+func (ip IP) Next() (IP, error) {
+	return ip.AddN(1)
+}
+
+// Returns the address preceding ip, or ErrIPOverflow if ip is the first address
+// of its family.
+func (ip IP) Prev() (IP, error) {
+	return ip.SubN(1)
+}
+
+func (ip IP) AddN(n uint64) (IP, error) {
+
+	if ip.IsZero() {
+		return IP{}, ErrUninitialized
+	}
+	x, carry := ip.AsUint128Cast().AddCarry(Uint128FromUint64(n), 0)
+	if carry != 0 || ip.Is4() && x.BitLen() > 32 {
+		return IP{}, ErrIPOverflow
 	}
-	return IPFromSlice(cs[:len(as)])
+	return ip_from_uint128(ip.Ver(), x), nil
+}
+
+func (ip IP) SubN(n uint64) (IP, error) {
+
+	if ip.IsZero() {
+		return IP{}, ErrUninitialized
+	}
+	x, borrow := ip.AsUint128Cast().SubBorrow(Uint128FromUint64(n), 0)
+	if borrow != 0 {
+		return IP{}, ErrIPOverflow
+	}
+	return ip_from_uint128(ip.Ver(), x), nil
+}
+
+// Returns the number of addresses between a and b, ie. |a - b|. The addresses
+// must be the same version.
+func (a IP) Distance(b IP) Uint128 {
+
+	if a.Ver() != b.Ver() {
+		panic("IP addresses are different length")
+	}
+	x := a.AsUint128Cast()
+	y := b.AsUint128Cast()
+	if x.Cmp(y) < 0 {
+		return y.Sub(x)
+	}
+	return x.Sub(y)
+}
+
+func (a IP) DistanceErr(b IP) (Uint128, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return Uint128{}, err
+	}
+	return a.Distance(b), nil
 }
 
 func (a IP) Compare(b IP) int {
@@ -343,17 +515,7 @@ func (a IP) Compare(b IP) int {
 
 	case a.Is6() && b.Is6():
 
-		as := a.AsSlice()
-		bs := b.AsSlice()
-		for i := 0; i < 16; i++ {
-			if as[i] < bs[i] {
-				return -1
-			}
-			if as[i] > bs[i] {
-				return 1
-			}
-		}
-		return 0
+		return a.AsUint128().Cmp(b.AsUint128())
 
 	case a.Is4() && b.Is6():
 
@@ -370,6 +532,27 @@ func (a IP) Compare(b IP) int {
 
 }
 
+// Unlike Compare, which orders IPv4 before IPv6, reports IPs of different
+// versions as an error.
+func (a IP) CompareErr(b IP) (int, error) {
+
+	if err := check_same_ver(a, b); err != nil {
+		return 0, err
+	}
+	return a.Compare(b), nil
+}
+
+func check_same_ver(a, b IP) error {
+
+	if a.IsZero() || b.IsZero() {
+		return ErrUninitialized
+	}
+	if a.Is4() != b.Is4() {
+		return ErrIPVersionMismatch
+	}
+	return nil
+}
+
 func IPBits(l, n int) IP {
 
 	if l != 4 && l != 16 {
@@ -386,6 +569,14 @@ func IPBits(l, n int) IP {
 	return IPFromSlice(bs[:l])
 }
 
+func IPBitsChecked(l, n int) (IP, error) {
+
+	if l != 4 && l != 16 {
+		return IP{}, ErrInvalidIPLength
+	}
+	return IPBits(l, n), nil
+}
+
 func IPNum(l int, n uint32) IP {
 
 	if l != 4 && l != 16 {
@@ -396,6 +587,14 @@ func IPNum(l int, n uint32) IP {
 	return IPFromSlice(bs[16 - l:])
 }
 
+func IPNumChecked(l int, n uint32) (IP, error) {
+
+	if l != 4 && l != 16 {
+		return IP{}, ErrInvalidIPLength
+	}
+	return IPNum(l, n), nil
+}
+
 func IPZero(l int) IP {
 	return IPNum(l, 0)
 }
@@ -0,0 +1,245 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestIPArithmetic(t *testing.T) {
+
+	test_cases := []struct {
+		ip  string
+		n   uint64
+		add string // "" means overflow
+		sub string
+	}{
+		{"10.0.0.255", 1, "10.0.1.0", "10.0.0.254"},
+		{"255.255.255.255", 1, "", "255.255.255.254"},
+		{"0.0.0.0", 1, "0.0.0.1", ""},
+		{"0.0.0.5", 1 << 32, "", ""},
+		{"::ffff:ffff", 1, "::1:0:0", "::ffff:fffe"},
+		{"::", 1, "::1", ""},
+		{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", 2, "", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffc"},
+		{"2001:db8::ffff:ffff:ffff:ffff", 1, "2001:db8:0:1::", "2001:db8::ffff:ffff:ffff:fffe"},
+	}
+
+	for i, c := range test_cases {
+
+		ip := MustParseIP(c.ip)
+		for _, op := range []struct {
+			name     string
+			fn       func(uint64) (IP, error)
+			expected string
+		}{
+			{"add", ip.AddN, c.add},
+			{"sub", ip.SubN, c.sub},
+		} {
+			res, err := op.fn(c.n)
+			if op.expected == "" {
+				if err != ErrIPOverflow {
+					t.Errorf("case %v: %v: expected overflow, got %v %v", i, op.name, res, err)
+				}
+				continue
+			}
+			if err != nil || res != MustParseIP(op.expected) {
+				t.Errorf("case %v: %v: expected %v, got %v %v", i, op.name, op.expected, res, err)
+				continue
+			}
+			if d := ip.Distance(res); d != Uint128FromUint64(c.n) {
+				t.Errorf("case %v: %v: unexpected distance %v", i, op.name, d)
+			}
+		}
+	}
+
+	p := MustParseIPPrefix("10.0.0.0/24")
+	if ip, err := p.Nth(Uint128FromUint64(255)); err != nil || ip != MustParseIP("10.0.0.255") {
+		t.Errorf("unexpected nth address %v %v", ip, err)
+	}
+	if _, err := p.Nth(Uint128FromUint64(256)); err != ErrIPOverflow {
+		t.Errorf("expected overflow from nth address")
+	}
+}
+
+func TestNonPanicking(t *testing.T) {
+
+	var zero IP
+	ip4 := MustParseIP("192.0.2.1")
+	ip6 := MustParseIP("2001:db8::1")
+	if _, err := zero.TryAsSlice(); err != ErrUninitialized {
+		t.Errorf("expected ErrUninitialized, got %v", err)
+	}
+	if _, err := ip6.TryAsUint32(); err != ErrNotIPv4 {
+		t.Errorf("expected ErrNotIPv4, got %v", err)
+	}
+	if _, err := ip4.CompareErr(ip6); err != ErrIPVersionMismatch {
+		t.Errorf("expected ErrIPVersionMismatch, got %v", err)
+	}
+	if _, err := ip4.OrErr(zero); err != ErrUninitialized {
+		t.Errorf("expected ErrUninitialized, got %v", err)
+	}
+	if _, err := IPFromSliceChecked([]byte{1, 2, 3}); err != ErrInvalidIPLength {
+		t.Errorf("expected ErrInvalidIPLength, got %v", err)
+	}
+	if _, err := IPPrefixFromChecked(ip4, 33); err != ErrInvalidPrefixLen {
+		t.Errorf("expected ErrInvalidPrefixLen, got %v", err)
+	}
+	if _, err := RefPrefixFromChecked(Ref{}, 129); err != ErrInvalidPrefixLen {
+		t.Errorf("expected ErrInvalidPrefixLen, got %v", err)
+	}
+	if c, err := ip4.CompareErr(MustParseIP("192.0.2.2")); err != nil || c != -1 {
+		t.Errorf("unexpected comparison result %v %v", c, err)
+	}
+	var pfx IPPrefix
+	for _, f := range []func() (IP, error){pfx.TryMask, pfx.TryHostMask, pfx.TryBroadcast} {
+		if _, err := f(); err != ErrUninitialized {
+			t.Errorf("expected ErrUninitialized, got %v", err)
+		}
+	}
+	if ip, err := MustParseIPPrefix("192.0.2.0/24").TryBroadcast(); err != nil || ip != MustParseIP("192.0.2.255") {
+		t.Errorf("unexpected broadcast %v %v", ip, err)
+	}
+	if subnets := pfx.Subnets(1); subnets != nil {
+		t.Errorf("expected no subnets of zero prefix, got %v", subnets)
+	}
+	if err := (AddrRec{EA: ip4, IP: ip4}).CheckEncodable(); err != ErrUninitialized {
+		t.Errorf("expected ErrUninitialized, got %v", err)
+	}
+	if err := (AddrRec{EA: ip4, IP: ip6, GW: ip4}).CheckEncodable(); err != ErrIPVersionMismatch {
+		t.Errorf("expected ErrIPVersionMismatch, got %v", err)
+	}
+}
+
+// Byte-wise reference implementation of the binary IP operations
+func ip_bytewise(a, b IP, op func(x, y byte, carry *uint16) byte) IP {
+
+	as := a.AsSlice()
+	bs := b.AsSlice()
+	cs := make([]byte, len(as))
+	var carry uint16
+	for i := len(as) - 1; i >= 0; i-- {
+		cs[i] = op(as[i], bs[i], &carry)
+	}
+	return IPFromSlice(cs)
+}
+
+func TestIPBitwise(t *testing.T) {
+
+	rnd := rand.New(rand.NewSource(1))
+	random_ip := func(l int) IP {
+		bs := make([]byte, l)
+		rnd.Read(bs)
+		if rnd.Intn(4) == 0 {
+			bs[l - 1] = 0xff
+		}
+		return IPFromSlice(bs)
+	}
+
+	for i := 0; i < 1000; i++ {
+		l := 4
+		if i % 2 == 1 {
+			l = 16
+		}
+		a := random_ip(l)
+		b := random_ip(l)
+		if x, y := a.Or(b), ip_bytewise(a, b, func(x, y byte, _ *uint16) byte { return x | y }); x != y {
+			t.Fatalf("%v | %v: expected %v, got %v", a, b, y, x)
+		}
+		if x, y := a.And(b), ip_bytewise(a, b, func(x, y byte, _ *uint16) byte { return x & y }); x != y {
+			t.Fatalf("%v & %v: expected %v, got %v", a, b, y, x)
+		}
+		if x, y := a.XOr(b), ip_bytewise(a, b, func(x, y byte, _ *uint16) byte { return x ^ y }); x != y {
+			t.Fatalf("%v ^ %v: expected %v, got %v", a, b, y, x)
+		}
+		if x, y := a.Not(), ip_bytewise(a, a, func(x, _ byte, _ *uint16) byte { return ^x }); x != y {
+			t.Fatalf("^%v: expected %v, got %v", a, y, x)
+		}
+		add := func(x, y byte, carry *uint16) byte {
+			*carry += uint16(x) + uint16(y)
+			z := byte(*carry)
+			*carry >>= 8
+			return z
+		}
+		if x, y := a.Add(b), ip_bytewise(a, b, add); x != y {
+			t.Fatalf("%v + %v: expected %v, got %v", a, b, y, x)
+		}
+		as := a.AsSlice()
+		if c := a.Compare(b); c != bytes.Compare(as, b.AsSlice()) {
+			t.Fatalf("comparing %v and %v: got %v", a, b, c)
+		}
+		if a.ByteFromEnd(0) != as[l - 1] || a.ByteFromEnd(l - 1) != as[0] {
+			t.Fatalf("unexpected bytes from end of %v", a)
+		}
+	}
+}
+
+func TestIPBitwiseAllocs(t *testing.T) {
+
+	for _, s := range []string{"10.1.2.3", "2001:db8::1"} {
+		a := MustParseIP(s)
+		b := a.Not()
+		allocs := testing.AllocsPerRun(100, func() {
+			a.Or(b).And(b).XOr(a).Not().Add(b).Compare(a)
+			a.ByteFromEnd(1)
+			a.IsZeroAddr()
+		})
+		if allocs != 0 {
+			t.Errorf("%v: IP operations allocate %v times", s, allocs)
+		}
+	}
+}
+
+func benchmark_ip_op(b *testing.B, op func(x, y IP) IP) {
+
+	for _, s := range []string{"10.1.2.3", "2001:db8::1"} {
+		x := MustParseIP(s)
+		y := x.Not()
+		b.Run("IPv" + strconv.Itoa(x.Ver()), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				x = op(x, y)
+			}
+		})
+	}
+}
+
+func BenchmarkIPOr(b *testing.B) {
+	benchmark_ip_op(b, func(x, y IP) IP { return x.Or(y) })
+}
+
+func BenchmarkIPAnd(b *testing.B) {
+	benchmark_ip_op(b, func(x, y IP) IP { return x.And(y) })
+}
+
+func BenchmarkIPXOr(b *testing.B) {
+	benchmark_ip_op(b, func(x, y IP) IP { return x.XOr(y) })
+}
+
+func BenchmarkIPNot(b *testing.B) {
+	benchmark_ip_op(b, func(x, _ IP) IP { return x.Not() })
+}
+
+func BenchmarkIPAdd(b *testing.B) {
+	benchmark_ip_op(b, func(x, y IP) IP { return x.Add(y) })
+}
+
+func BenchmarkIPCompare(b *testing.B) {
+
+	var c int
+	benchmark_ip_op(b, func(x, y IP) IP {
+		c += x.Compare(y)
+		return x
+	})
+}
+
+func BenchmarkIPByteFromEnd(b *testing.B) {
+
+	var c byte
+	benchmark_ip_op(b, func(x, _ IP) IP {
+		c += x.ByteFromEnd(2)
+		return x
+	})
+}
@@ -0,0 +1,240 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+// Classification of IP addresses per the IANA special-purpose address registries
+// (RFC 6890 and updates), and of multicast addresses by scope.
+type IPClass int
+
+const ( // ip address classes
+
+	IP_CLASS_INVALID           IPClass = iota // uninitialized IP or IPPrefix
+	IP_CLASS_GLOBAL                           // globally routable unicast
+	IP_CLASS_UNSPECIFIED                      // 0.0.0.0, ::
+	IP_CLASS_THIS_NETWORK                     // 0.0.0.0/8
+	IP_CLASS_PRIVATE                          // RFC 1918
+	IP_CLASS_SHARED                           // RFC 6598 CGNAT 100.64.0.0/10
+	IP_CLASS_LOOPBACK                         // 127.0.0.0/8, ::1
+	IP_CLASS_LINK_LOCAL                       // 169.254.0.0/16, fe80::/10
+	IP_CLASS_ULA                              // RFC 4193 fc00::/7
+	IP_CLASS_SITE_LOCAL                       // deprecated fec0::/10
+	IP_CLASS_DOCUMENTATION                    // RFC 5737, RFC 3849, RFC 9637
+	IP_CLASS_BENCHMARKING                     // 198.18.0.0/15, 2001:2::/48
+	IP_CLASS_IETF_PROTOCOL                    // 192.0.0.0/24, 2001::/23
+	IP_CLASS_DISCARD                          // RFC 6666 100::/64
+	IP_CLASS_IPV4_MAPPED                      // ::ffff:0:0/96
+	IP_CLASS_IPV4_TRANSLATED                  // ::ffff:0:0:0/96
+	IP_CLASS_6TO4                             // 2002::/16, 192.88.99.0/24
+	IP_CLASS_TEREDO                           // 2001::/32
+	IP_CLASS_NAT64                            // RFC 6052 64:ff9b::/96
+	IP_CLASS_NAT64_LOCAL                      // RFC 8215 64:ff9b:1::/48
+	IP_CLASS_ORCHID                           // 2001:10::/28, 2001:20::/28
+	IP_CLASS_AS112                            // RFC 7534, RFC 7535
+	IP_CLASS_AMT                              // RFC 7450
+	IP_CLASS_RESERVED                         // 240.0.0.0/4, unallocated IPv6
+	IP_CLASS_BROADCAST                        // 255.255.255.255
+	IP_CLASS_MULTICAST_INTERFACE_LOCAL
+	IP_CLASS_MULTICAST_LINK_LOCAL
+	IP_CLASS_MULTICAST_REALM_LOCAL
+	IP_CLASS_MULTICAST_ADMIN_LOCAL
+	IP_CLASS_MULTICAST_SITE_LOCAL
+	IP_CLASS_MULTICAST_ORG_LOCAL
+	IP_CLASS_MULTICAST_GLOBAL
+	IP_CLASS_MULTICAST_OTHER // reserved or unassigned IPv6 multicast scope
+	IP_CLASS_MIXED           // prefix spans more than one class
+)
+
+var ip_class_names = [...]string{
+	IP_CLASS_INVALID:                   "invalid",
+	IP_CLASS_GLOBAL:                    "global",
+	IP_CLASS_UNSPECIFIED:               "unspecified",
+	IP_CLASS_THIS_NETWORK:              "this-network",
+	IP_CLASS_PRIVATE:                   "private",
+	IP_CLASS_SHARED:                    "shared",
+	IP_CLASS_LOOPBACK:                  "loopback",
+	IP_CLASS_LINK_LOCAL:                "link-local",
+	IP_CLASS_ULA:                       "ula",
+	IP_CLASS_SITE_LOCAL:                "site-local",
+	IP_CLASS_DOCUMENTATION:             "documentation",
+	IP_CLASS_BENCHMARKING:              "benchmarking",
+	IP_CLASS_IETF_PROTOCOL:             "ietf-protocol",
+	IP_CLASS_DISCARD:                   "discard",
+	IP_CLASS_IPV4_MAPPED:               "ipv4-mapped",
+	IP_CLASS_IPV4_TRANSLATED:           "ipv4-translated",
+	IP_CLASS_6TO4:                      "6to4",
+	IP_CLASS_TEREDO:                    "teredo",
+	IP_CLASS_NAT64:                     "nat64",
+	IP_CLASS_NAT64_LOCAL:               "nat64-local",
+	IP_CLASS_ORCHID:                    "orchid",
+	IP_CLASS_AS112:                     "as112",
+	IP_CLASS_AMT:                       "amt",
+	IP_CLASS_RESERVED:                  "reserved",
+	IP_CLASS_BROADCAST:                 "broadcast",
+	IP_CLASS_MULTICAST_INTERFACE_LOCAL: "multicast-interface-local",
+	IP_CLASS_MULTICAST_LINK_LOCAL:      "multicast-link-local",
+	IP_CLASS_MULTICAST_REALM_LOCAL:     "multicast-realm-local",
+	IP_CLASS_MULTICAST_ADMIN_LOCAL:     "multicast-admin-local",
+	IP_CLASS_MULTICAST_SITE_LOCAL:      "multicast-site-local",
+	IP_CLASS_MULTICAST_ORG_LOCAL:       "multicast-org-local",
+	IP_CLASS_MULTICAST_GLOBAL:          "multicast-global",
+	IP_CLASS_MULTICAST_OTHER:           "multicast-other",
+	IP_CLASS_MIXED:                     "mixed",
+}
+
+func (c IPClass) String() string {
+
+	if c < 0 || int(c) >= len(ip_class_names) {
+		return "unknown"
+	}
+	return ip_class_names[c]
+}
+
+// Whether addresses of the class are unicast and reachable across the Internet.
+// Suitable for gateway addresses.
+func (c IPClass) IsGlobal() bool {
+
+	switch c {
+	case IP_CLASS_GLOBAL, IP_CLASS_NAT64, IP_CLASS_AS112, IP_CLASS_AMT:
+		return true
+	}
+	return false
+}
+
+func (c IPClass) IsMulticast() bool {
+	return c >= IP_CLASS_MULTICAST_INTERFACE_LOCAL && c <= IP_CLASS_MULTICAST_OTHER
+}
+
+// Whether addresses of the class are used only within a site or organization,
+// and may be used as encoding addresses.
+func (c IPClass) IsPrivate() bool {
+
+	switch c {
+	case IP_CLASS_PRIVATE, IP_CLASS_SHARED, IP_CLASS_ULA:
+		return true
+	}
+	return false
+}
+
+var ip_class_table IPPrefixTable[IPClass]
+
+func init() {
+
+	for _, e := range []struct {
+		prefix string
+		class  IPClass
+	}{
+		{"0.0.0.0/0", IP_CLASS_GLOBAL},
+		{"0.0.0.0/8", IP_CLASS_THIS_NETWORK},
+		{"0.0.0.0/32", IP_CLASS_UNSPECIFIED},
+		{"10.0.0.0/8", IP_CLASS_PRIVATE},
+		{"100.64.0.0/10", IP_CLASS_SHARED},
+		{"127.0.0.0/8", IP_CLASS_LOOPBACK},
+		{"169.254.0.0/16", IP_CLASS_LINK_LOCAL},
+		{"172.16.0.0/12", IP_CLASS_PRIVATE},
+		{"192.0.0.0/24", IP_CLASS_IETF_PROTOCOL},
+		{"192.0.2.0/24", IP_CLASS_DOCUMENTATION},
+		{"192.31.196.0/24", IP_CLASS_AS112},
+		{"192.52.193.0/24", IP_CLASS_AMT},
+		{"192.88.99.0/24", IP_CLASS_6TO4},
+		{"192.168.0.0/16", IP_CLASS_PRIVATE},
+		{"192.175.48.0/24", IP_CLASS_AS112},
+		{"198.18.0.0/15", IP_CLASS_BENCHMARKING},
+		{"198.51.100.0/24", IP_CLASS_DOCUMENTATION},
+		{"203.0.113.0/24", IP_CLASS_DOCUMENTATION},
+		{"224.0.0.0/4", IP_CLASS_MULTICAST_GLOBAL},
+		{"224.0.0.0/24", IP_CLASS_MULTICAST_LINK_LOCAL},
+		{"239.0.0.0/8", IP_CLASS_MULTICAST_ADMIN_LOCAL},
+		{"239.192.0.0/14", IP_CLASS_MULTICAST_ORG_LOCAL},
+		{"239.255.0.0/16", IP_CLASS_MULTICAST_SITE_LOCAL},
+		{"240.0.0.0/4", IP_CLASS_RESERVED},
+		{"255.255.255.255/32", IP_CLASS_BROADCAST},
+
+		{"::/0", IP_CLASS_RESERVED},
+		{"::/128", IP_CLASS_UNSPECIFIED},
+		{"::1/128", IP_CLASS_LOOPBACK},
+		{"::ffff:0:0/96", IP_CLASS_IPV4_MAPPED},
+		{"::ffff:0:0:0/96", IP_CLASS_IPV4_TRANSLATED},
+		{"64:ff9b::/96", IP_CLASS_NAT64},
+		{"64:ff9b:1::/48", IP_CLASS_NAT64_LOCAL},
+		{"100::/64", IP_CLASS_DISCARD},
+		{"2000::/3", IP_CLASS_GLOBAL},
+		{"2001::/23", IP_CLASS_IETF_PROTOCOL},
+		{"2001::/32", IP_CLASS_TEREDO},
+		{"2001:1::1/128", IP_CLASS_GLOBAL},
+		{"2001:1::2/128", IP_CLASS_GLOBAL},
+		{"2001:1::3/128", IP_CLASS_GLOBAL},
+		{"2001:2::/48", IP_CLASS_BENCHMARKING},
+		{"2001:3::/32", IP_CLASS_AMT},
+		{"2001:4:112::/48", IP_CLASS_AS112},
+		{"2001:10::/28", IP_CLASS_ORCHID},
+		{"2001:20::/28", IP_CLASS_ORCHID},
+		{"2001:30::/28", IP_CLASS_GLOBAL},
+		{"2001:db8::/32", IP_CLASS_DOCUMENTATION},
+		{"2002::/16", IP_CLASS_6TO4},
+		{"2620:4f:8000::/48", IP_CLASS_AS112},
+		{"3fff::/20", IP_CLASS_DOCUMENTATION},
+		{"fc00::/7", IP_CLASS_ULA},
+		{"fe80::/10", IP_CLASS_LINK_LOCAL},
+		{"fec0::/10", IP_CLASS_SITE_LOCAL},
+		{"ff00::/8", IP_CLASS_MULTICAST_OTHER}, // refined by scope
+	} {
+		ip_class_table.Insert(MustParseIPPrefix(e.prefix), e.class)
+	}
+}
+
+// IPv6 multicast classes indexed by the scope nibble (RFC 4291, RFC 7346)
+var ip_class_mcast6_scopes = [16]IPClass{
+	1:  IP_CLASS_MULTICAST_INTERFACE_LOCAL,
+	2:  IP_CLASS_MULTICAST_LINK_LOCAL,
+	3:  IP_CLASS_MULTICAST_REALM_LOCAL,
+	4:  IP_CLASS_MULTICAST_ADMIN_LOCAL,
+	5:  IP_CLASS_MULTICAST_SITE_LOCAL,
+	8:  IP_CLASS_MULTICAST_ORG_LOCAL,
+	14: IP_CLASS_MULTICAST_GLOBAL,
+}
+
+func ip_class_mcast6(ip IP) IPClass {
+
+	if c := ip_class_mcast6_scopes[ip.AsUint128().H >> 48 & 0xf]; c != 0 {
+		return c
+	}
+	return IP_CLASS_MULTICAST_OTHER
+}
+
+func (ip IP) Class() IPClass {
+
+	if ip.IsZero() {
+		return IP_CLASS_INVALID
+	}
+	c, _ := ip_class_table.Lookup(ip)
+	if c == IP_CLASS_MULTICAST_OTHER {
+		c = ip_class_mcast6(ip)
+	}
+	return c
+}
+
+// Returns the class of all addresses in the prefix, or IP_CLASS_MIXED if they
+// don't all belong to the same class.
+func (p IPPrefix) Class() IPClass {
+
+	if p == (IPPrefix{}) {
+		return IP_CLASS_INVALID
+	}
+	_, c, _ := ip_class_table.LookupPrefix(p)
+	mixed := false
+	ip_class_table.CoveredBy(p, func(q IPPrefix, qc IPClass) bool {
+		mixed = q != p && qc != c
+		return !mixed
+	})
+	if mixed {
+		return IP_CLASS_MIXED
+	}
+	if c == IP_CLASS_MULTICAST_OTHER {
+		// the scope nibble ends at bit 16
+		if p.Bits() < 16 {
+			return IP_CLASS_MIXED
+		}
+		c = ip_class_mcast6(p.Addr())
+	}
+	return c
+}
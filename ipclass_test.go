@@ -0,0 +1,68 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "testing"
+
+func TestIPClass(t *testing.T) {
+
+	test_cases := []struct {
+		addr  string
+		class IPClass
+	}{
+		{"8.8.8.8", IP_CLASS_GLOBAL},
+		{"0.0.0.0", IP_CLASS_UNSPECIFIED},
+		{"0.1.2.3", IP_CLASS_THIS_NETWORK},
+		{"10.240.0.5", IP_CLASS_PRIVATE},
+		{"172.31.255.255", IP_CLASS_PRIVATE},
+		{"172.32.0.0", IP_CLASS_GLOBAL},
+		{"100.64.0.1", IP_CLASS_SHARED},
+		{"127.0.0.1", IP_CLASS_LOOPBACK},
+		{"192.0.2.1", IP_CLASS_DOCUMENTATION},
+		{"198.19.0.1", IP_CLASS_BENCHMARKING},
+		{"224.0.0.251", IP_CLASS_MULTICAST_LINK_LOCAL},
+		{"239.255.255.250", IP_CLASS_MULTICAST_SITE_LOCAL},
+		{"250.1.1.1", IP_CLASS_RESERVED},
+		{"255.255.255.255", IP_CLASS_BROADCAST},
+		{"::", IP_CLASS_UNSPECIFIED},
+		{"::1", IP_CLASS_LOOPBACK},
+		{"::ffff:10.0.0.1", IP_CLASS_IPV4_MAPPED},
+		{"64:ff9b::192.0.2.1", IP_CLASS_NAT64},
+		{"2001::1", IP_CLASS_TEREDO},
+		{"2001:db8::1", IP_CLASS_DOCUMENTATION},
+		{"2002:c000:201::1", IP_CLASS_6TO4},
+		{"2600::1", IP_CLASS_GLOBAL},
+		{"fd00::1", IP_CLASS_ULA},
+		{"fe80::1", IP_CLASS_LINK_LOCAL},
+		{"ff02::1", IP_CLASS_MULTICAST_LINK_LOCAL},
+		{"ff15::1", IP_CLASS_MULTICAST_SITE_LOCAL},
+		{"ff0e::1", IP_CLASS_MULTICAST_GLOBAL},
+		{"ff06::1", IP_CLASS_MULTICAST_OTHER},
+		{"4000::1", IP_CLASS_RESERVED},
+	}
+	for i, c := range test_cases {
+		if class := MustParseIP(c.addr).Class(); class != c.class {
+			t.Errorf("case %v: %v: expected %v, got %v", i, c.addr, c.class, class)
+		}
+	}
+
+	prefix_cases := []struct {
+		prefix string
+		class  IPClass
+	}{
+		{"10.240.0.0/12", IP_CLASS_PRIVATE},
+		{"10.0.0.0/7", IP_CLASS_MIXED},
+		{"192.0.0.0/16", IP_CLASS_MIXED},
+		{"198.51.100.128/25", IP_CLASS_DOCUMENTATION},
+		{"2001:db8:1::/48", IP_CLASS_DOCUMENTATION},
+		{"2000::/3", IP_CLASS_MIXED},
+		{"2600::/12", IP_CLASS_GLOBAL},
+		{"ff02::/16", IP_CLASS_MULTICAST_LINK_LOCAL},
+		{"ff00::/8", IP_CLASS_MIXED},
+	}
+	for i, c := range prefix_cases {
+		if class := MustParseIPPrefix(c.prefix).Class(); class != c.class {
+			t.Errorf("case %v: %v: expected %v, got %v", i, c.prefix, c.class, class)
+		}
+	}
+}
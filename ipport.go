@@ -0,0 +1,158 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"golang.org/x/sys/unix"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+const IPREF_TUNNEL_PORT = 1045 // UDP tunnel port, proposed
+
+// An IP address and port, eg. a tunnel endpoint. IPv6 link-local endpoints
+// may have a zone (scope), an interface name or number, which is kept apart
+// from the IP, since IPs have no zones.
+type IPPort struct {
+	IP   IP
+	Port uint16
+	Zone string // eg. "eth0" or "2", IPv6 only, empty if none
+}
+
+func (ipp IPPort) IsZero() bool {
+	return ipp == IPPort{}
+}
+
+// Formats as 192.0.2.1:1045, [2001:db8::1]:1045 or [fe80::1%eth0]:1045
+func (ipp IPPort) String() string {
+
+	if ipp.IP.IsZero() {
+		return "(uninitialized)"
+	}
+	port := strconv.Itoa(int(ipp.Port))
+	if ipp.IP.Is4() {
+		return ipp.IP.String() + ":" + port
+	}
+	if ipp.Zone != "" {
+		return "[" + ipp.IP.String() + "%" + ipp.Zone + "]:" + port
+	}
+	return "[" + ipp.IP.String() + "]:" + port
+}
+
+func ParseIPPort(s string) (IPPort, error) {
+
+	ap, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return IPPort{}, err
+	}
+	return IPPortFromAddrPort(ap)
+}
+
+func MustParseIPPort(s string) IPPort {
+
+	ipp, err := ParseIPPort(s)
+	if err != nil {
+		panic("invalid IP address and port")
+	}
+	return ipp
+}
+
+func (ipp IPPort) AsAddrPort() netip.AddrPort {
+	return netip.AddrPortFrom(netip.Addr(ipp.IP).WithZone(ipp.Zone), ipp.Port)
+}
+
+func IPPortFromAddrPort(ap netip.AddrPort) (IPPort, error) {
+
+	if !ap.Addr().IsValid() {
+		return IPPort{}, errors.New("invalid IP address")
+	}
+	return IPPort{IP(ap.Addr().WithZone("")), ap.Port(), ap.Addr().Zone()}, nil
+}
+
+func (ipp IPPort) AsUDPAddr() (*net.UDPAddr, error) {
+
+	ip, err := ipp.IP.TryAsSlice()
+	if err != nil {
+		return nil, err
+	}
+	return &net.UDPAddr{IP: ip, Port: int(ipp.Port), Zone: ipp.Zone}, nil
+}
+
+func IPPortFromUDPAddr(addr *net.UDPAddr) (IPPort, error) {
+
+	if addr == nil {
+		return IPPort{}, errors.New("nil UDP address")
+	}
+	if addr.Port < 0 || addr.Port > 0xffff {
+		return IPPort{}, errors.New("invalid port")
+	}
+	ip, ok := netip.AddrFromSlice(addr.IP)
+	if !ok {
+		return IPPort{}, errors.New("invalid IP address")
+	}
+	// net.IP holds IPv4 addresses in 16 bytes
+	return IPPort{IP(ip.Unmap()), uint16(addr.Port), addr.Zone}, nil
+}
+
+// Returns the socket address. The zone, if any, must be an interface number or
+// the name of an existing interface.
+func (ipp IPPort) AsUnixSockaddr() (unix.Sockaddr, error) {
+
+	if ipp.IP.IsZero() {
+		return nil, ErrUninitialized
+	}
+	if ipp.IP.Is4() {
+		addr := unix.SockaddrInet4{Port: int(ipp.Port)}
+		addr.Addr = netip.Addr(ipp.IP).As4()
+		return &addr, nil
+	}
+	zoneid, err := zone_id(ipp.Zone)
+	if err != nil {
+		return nil, err
+	}
+	addr := unix.SockaddrInet6{Port: int(ipp.Port), ZoneId: zoneid}
+	addr.Addr = netip.Addr(ipp.IP).As16()
+	return &addr, nil
+}
+
+// Unlike IPFromUnixSockaddr, reports unsupported address families as errors.
+// The scope ID is returned as the zone, in its numeric form, so decoding takes
+// no interface lookup.
+func IPPortFromUnixSockaddr(addr unix.Sockaddr) (IPPort, error) {
+
+	switch a := addr.(type) {
+	case *unix.SockaddrInet4:
+		return IPPort{IP: IP(netip.AddrFrom4(a.Addr)), Port: uint16(a.Port)}, nil
+	case *unix.SockaddrInet6:
+		return IPPort{IP(netip.AddrFrom16(a.Addr)), uint16(a.Port), zone_name(a.ZoneId)}, nil
+	case nil:
+		return IPPort{}, errors.New("nil socket address")
+	default:
+		return IPPort{}, errors.New("unsupported socket address family")
+	}
+}
+
+func zone_id(zone string) (uint32, error) {
+
+	if zone == "" {
+		return 0, nil
+	}
+	if id, err := strconv.ParseUint(zone, 10, 32); err == nil {
+		return uint32(id), nil
+	}
+	ifc, err := net.InterfaceByName(zone)
+	if err != nil {
+		return 0, err
+	}
+	return uint32(ifc.Index), nil
+}
+
+func zone_name(id uint32) string {
+
+	if id == 0 {
+		return ""
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
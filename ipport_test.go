@@ -0,0 +1,78 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"golang.org/x/sys/unix"
+	"net"
+	"strconv"
+	"testing"
+)
+
+func TestIPPort(t *testing.T) {
+
+	for _, s := range []string{"192.0.2.1:1045", "[2001:db8::1]:1045", "[::ffff:10.0.0.1]:53",
+		"[fe80::1%9999]:1045"} {
+
+		ipp, err := ParseIPPort(s)
+		if err != nil {
+			t.Errorf("%v: unexpected error: %v", s, err)
+			continue
+		}
+		if ipp.String() != s {
+			t.Errorf("%v: formatted as %v", s, ipp)
+		}
+		if sa, err := ipp.AsUnixSockaddr(); err != nil {
+			t.Errorf("%v: unexpected sockaddr error: %v", s, err)
+		} else if x, err := IPPortFromUnixSockaddr(sa); err != nil || x != ipp {
+			t.Errorf("%v: sockaddr round trip: %v %v", s, x, err)
+		}
+		if x, err := IPPortFromAddrPort(ipp.AsAddrPort()); err != nil || x != ipp {
+			t.Errorf("%v: netip round trip: %v %v", s, x, err)
+		}
+		if ua, err := ipp.AsUDPAddr(); err != nil {
+			t.Errorf("%v: unexpected net.UDPAddr error: %v", s, err)
+		} else if x, err := IPPortFromUDPAddr(ua); err != nil || x.Port != ipp.Port ||
+			x.IP.Un4In6() != ipp.IP.Un4In6() || x.Zone != ipp.Zone {
+
+			t.Errorf("%v: net.UDPAddr round trip: %v %v", s, x, err)
+		}
+	}
+	ipp := MustParseIPPort("[fe80::1%9999]:1045")
+	if ipp.IP != MustParseIP("fe80::1") || ipp.Zone != "9999" {
+		t.Errorf("zone not kept apart from the IP: %#v", ipp)
+	}
+	if sa, _ := ipp.AsUnixSockaddr(); sa.(*unix.SockaddrInet6).ZoneId != 9999 {
+		t.Errorf("unexpected scope ID: %+v", sa)
+	}
+	if ifcs, err := net.Interfaces(); err == nil && len(ifcs) > 0 {
+		ipp.Zone = ifcs[0].Name
+		sa, err := ipp.AsUnixSockaddr()
+		if err != nil || sa.(*unix.SockaddrInet6).ZoneId != uint32(ifcs[0].Index) {
+			t.Errorf("%v: unexpected scope ID: %+v %v", ipp, sa, err)
+		} else if x, err := IPPortFromUnixSockaddr(sa); err != nil || x.Zone != strconv.Itoa(ifcs[0].Index) {
+			t.Errorf("%v: expected numeric zone, got %v %v", ipp, x, err)
+		}
+	}
+	ipp.Zone = "no-such-interface"
+	if _, err := ipp.AsUnixSockaddr(); err == nil {
+		t.Errorf("expected error for unknown zone")
+	}
+	for _, s := range []string{"192.0.2.1", "192.0.2.1:65536"} {
+		if _, err := ParseIPPort(s); err == nil {
+			t.Errorf("expected error parsing %v", s)
+		}
+	}
+	if _, err := IPPortFromUnixSockaddr(&unix.SockaddrUnix{Name: "/tmp/x"}); err == nil {
+		t.Errorf("expected error decoding unix socket address")
+	}
+	if _, err := (IPPort{}).AsUDPAddr(); err != ErrUninitialized {
+		t.Errorf("expected ErrUninitialized from zero AsUDPAddr, got %v", err)
+	}
+	if _, err := (IPPort{}).AsUnixSockaddr(); err != ErrUninitialized {
+		t.Errorf("expected ErrUninitialized from zero AsUnixSockaddr, got %v", err)
+	}
+	if ip := IPFromUnixSockaddr(&unix.SockaddrInet6{Addr: [16]byte{0xfe, 0x80, 15: 1}, ZoneId: 9999}); ip != MustParseIP("fe80::1") {
+		t.Errorf("unexpected IP from sockaddr %v", ip)
+	}
+}
@@ -5,6 +5,7 @@ package ref
 import (
 	"errors"
 	"net/netip"
+	"strings"
 )
 
 type IPPrefix netip.Prefix // .Addr().Zone() must be "", and must be .Masked()
@@ -21,14 +22,92 @@ func (p IPPrefix) SizeBits() int {
 	return p.Addr().Len() * 8 - p.Bits()
 }
 
+func (p IPPrefix) TrySizeBits() (int, error) {
+
+	if p == (IPPrefix{}) {
+		return 0, ErrUninitialized
+	}
+	return p.SizeBits(), nil
+}
+
 func IPPrefixFrom(ip IP, bits int) IPPrefix {
 	return IPPrefix(netip.PrefixFrom(netip.Addr(ip), bits).Masked())
 }
 
+// Unlike IPPrefixFrom, which returns an invalid prefix, reports an
+// uninitialized IP or an out of range prefix length as an error.
+func IPPrefixFromChecked(ip IP, bits int) (IPPrefix, error) {
+
+	if ip.IsZero() {
+		return IPPrefix{}, ErrUninitialized
+	}
+	if bits < 0 || bits > ip.Len() * 8 {
+		return IPPrefix{}, ErrInvalidPrefixLen
+	}
+	return IPPrefixFrom(ip, bits), nil
+}
+
 func IPPrefixAllVer(ipver int) IPPrefix {
 	return IPPrefixFrom(IPZero(IPVerToLen(ipver)), 0)
 }
 
+// Returns the prefix of ip with the given netmask, eg. 255.255.255.0. The mask
+// must be contiguous and the same version as ip.
+func IPPrefixFromMask(ip, mask IP) (IPPrefix, error) {
+
+	if ip.IsZero() || mask.IsZero() {
+		return IPPrefix{}, ErrUninitialized
+	}
+	if ip.Ver() != mask.Ver() {
+		return IPPrefix{}, ErrIPVersionMismatch
+	}
+	m := mask.AsUint128Cast().Lsh(uint(128 - mask.Len() * 8))
+	bits := m.Compl().LeadingZeros()
+	if m != UINT128_MAX.Lsh(uint(128 - bits)) {
+		return IPPrefix{}, ErrNonContiguousMask
+	}
+	return IPPrefixFrom(ip, bits), nil
+}
+
+func (p IPPrefix) Mask() IP {
+	return IPBits(p.Addr().Len(), p.Bits())
+}
+
+func (p IPPrefix) TryMask() (IP, error) {
+
+	if p == (IPPrefix{}) {
+		return IP{}, ErrUninitialized
+	}
+	return p.Mask(), nil
+}
+
+// Returns the inverse of the netmask, also known as the wildcard mask.
+func (p IPPrefix) HostMask() IP {
+	return p.Mask().Not()
+}
+
+func (p IPPrefix) TryHostMask() (IP, error) {
+
+	if p == (IPPrefix{}) {
+		return IP{}, ErrUninitialized
+	}
+	return p.HostMask(), nil
+}
+
+// Returns the all-ones host address, ie. the IPv4 broadcast address. It is the
+// same as Last().
+func (p IPPrefix) Broadcast() IP {
+	return p.Addr().Or(p.HostMask())
+}
+
+func (p IPPrefix) TryBroadcast() (IP, error) {
+
+	if p == (IPPrefix{}) {
+		return IP{}, ErrUninitialized
+	}
+	return p.Broadcast(), nil
+}
+
 func (p IPPrefix) String() string {
 	return netip.Prefix(p).String()
 }
@@ -45,6 +124,32 @@ func ParseIPPrefix(s string) (IPPrefix, error) {
 	return IPPrefix(p.Masked()), nil
 }
 
+// Like ParseIPPrefix but also accepts the legacy forms addr/mask and addr mask,
+// eg. 192.0.2.0/255.255.255.0 or "192.0.2.0 255.255.255.0".
+func ParseIPPrefixMask(s string) (IPPrefix, error) {
+
+	addr, mask, found := strings.Cut(strings.TrimSpace(s), "/")
+	if !found {
+		fields := strings.Fields(s)
+		if len(fields) != 2 {
+			return IPPrefix{}, errors.New("invalid format (expected addr/mask or addr mask)")
+		}
+		addr, mask = fields[0], fields[1]
+	}
+	if !strings.ContainsAny(mask, ".:") {
+		return ParseIPPrefix(addr + "/" + mask)
+	}
+	ip, err := ParseIP(strings.TrimSpace(addr))
+	if err != nil {
+		return IPPrefix{}, err
+	}
+	m, err := ParseIP(strings.TrimSpace(mask))
+	if err != nil {
+		return IPPrefix{}, err
+	}
+	return IPPrefixFromMask(ip, m)
+}
+
 func MustParseIPPrefix(s string) IPPrefix {
 
 	p, err := ParseIPPrefix(s)
@@ -66,6 +171,57 @@ func (p IPPrefix) Contains(ip IP) bool {
 	return netip.Prefix(p).Contains(netip.Addr(ip))
 }
 
+func (a IPPrefix) ContainsPrefix(b IPPrefix) bool {
+	return a.Bits() <= b.Bits() && a.Contains(b.Addr())
+}
+
+func (a IPPrefix) Overlaps(b IPPrefix) bool {
+	return netip.Prefix(a).Overlaps(netip.Prefix(b))
+}
+
+// Returns the prefix of length 'bits' which contains p. If bits is invalid, then
+// the zero IPPrefix is returned.
+func (p IPPrefix) Supernet(bits int) IPPrefix {
+
+	if bits < 0 || bits > p.Bits() {
+		return IPPrefix{}
+	}
+	return IPPrefixFrom(p.Addr(), bits)
+}
+
+// Returns the last address in the prefix.
+func (p IPPrefix) Last() IP {
+	return p.Range().To()
+}
+
+func (p IPPrefix) Range() IPRange {
+
+	if p == (IPPrefix{}) {
+		return IPRange{}
+	}
+	ip := p.Addr()
+	host := UINT128_1.Lsh(uint(p.SizeBits())).Sub(UINT128_1)
+	return IPRange{ip, ip_from_uint128(ip.Ver(), ip.AsUint128Cast().Or(host))}
+}
+
+// Returns the minimal list of prefixes which cover the addresses in a that
+// aren't in b, in order.
+func (a IPPrefix) Subtract(b IPPrefix) []IPPrefix {
+
+	var prefixes []IPPrefix
+	for _, r := range ip_range_subtract(a.Range(), b.Range()) {
+		prefixes = append(prefixes, r.Prefixes()...)
+	}
+	return prefixes
+}
+
+// Returns the minimal list of prefixes which cover the same addresses as the
+// given prefixes, in order. Covered prefixes are removed, and adjacent prefixes
+// are merged.
+func AggregatePrefixes(prefixes []IPPrefix) []IPPrefix {
+	return IPSetFromPrefixes(prefixes).Prefixes()
+}
+
 func IPPrefixesContain(prefixes []IPPrefix, ip IP) bool {
 
 	for _, prefix := range prefixes {
@@ -77,9 +233,12 @@ func IPPrefixesContain(prefixes []IPPrefix, ip IP) bool {
 }
 
 // Returns the 2^l subnets of prefix length 'a.Bits() + l' within a, in order.
-// If l is invalid, then nil is returned.
+// If a is uninitialized or l is invalid, then nil is returned.
 func (a IPPrefix) Subnets(l int) []IPPrefix {
 
+	if a == (IPPrefix{}) {
+		return nil
+	}
 	ip := a.Addr().AsUint128Cast()
 	alen := a.Bits()
 	if a.Addr().Ver() == 4 {
@@ -102,3 +261,17 @@ func (a IPPrefix) Subnets(l int) []IPPrefix {
 	}
 	return prefixes
 }
+
+// Returns the n'th address in the prefix, counting from zero, or ErrIPOverflow
+// if the prefix has fewer than n + 1 addresses.
+func (p IPPrefix) Nth(n Uint128) (IP, error) {
+
+	if p == (IPPrefix{}) {
+		return IP{}, ErrUninitialized
+	}
+	if n.BitLen() > p.SizeBits() {
+		return IP{}, ErrIPOverflow
+	}
+	ip := p.Addr()
+	return ip_from_uint128(ip.Ver(), ip.AsUint128Cast().Or(n)), nil
+}
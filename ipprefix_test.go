@@ -0,0 +1,36 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "testing"
+
+func TestIPPrefixMask(t *testing.T) {
+
+	for _, c := range []struct {
+		str    string
+		prefix string
+	}{
+		{"192.0.2.0/255.255.255.0", "192.0.2.0/24"},
+		{"192.0.2.77 255.255.255.192", "192.0.2.64/26"},
+		{"10.0.0.0/8", "10.0.0.0/8"},
+		{"0.0.0.0 0.0.0.0", "0.0.0.0/0"},
+		{"2001:db8::/ffff:ffff::", "2001:db8::/32"},
+	} {
+		p, err := ParseIPPrefixMask(c.str)
+		if err != nil || p != MustParseIPPrefix(c.prefix) {
+			t.Errorf("%q: expected %v, got %v %v", c.str, c.prefix, p, err)
+		}
+	}
+	for _, s := range []string{"192.0.2.0/255.0.255.0", "192.0.2.0 255.255.255.0 1",
+		"192.0.2.0/ffff::"} {
+		if p, err := ParseIPPrefixMask(s); err == nil {
+			t.Errorf("%q: expected error, got %v", s, p)
+		}
+	}
+
+	p := MustParseIPPrefix("192.0.2.64/26")
+	if p.Mask() != MustParseIP("255.255.255.192") || p.HostMask() != MustParseIP("0.0.0.63") ||
+		p.Broadcast() != MustParseIP("192.0.2.127") {
+		t.Errorf("unexpected masks %v %v %v", p.Mask(), p.HostMask(), p.Broadcast())
+	}
+}
@@ -0,0 +1,345 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * IPPrefixTable is a longest-prefix-match table mapping IP prefixes to values.
+ * IPv4 and IPv6 prefixes are kept in separate path-compressed binary tries.
+ * Nodes are never modified once they're part of a trie - updates copy the path
+ * from the root to the changed node. That makes Snapshot() O(1), and allows
+ * snapshots to be read concurrently with updates to the table they came from.
+ * A single table must not be updated concurrently, nor read while it's being
+ * updated. Use IPPrefixTableAtomic to publish snapshots to concurrent readers.
+ */
+
+type IPPrefixTable[V any] struct {
+	roots [2]*ipt_node[V] // IPv4, IPv6
+	count int
+}
+
+type ipt_node[V any] struct {
+	key   Uint128 // left-aligned, bits past 'bits' are zero
+	bits  int
+	has   bool // whether the node holds a value or is only a branch point
+	val   V
+	child [2]*ipt_node[V]
+}
+
+// Returns the trie index and the left-aligned key of the address.
+func ipt_key(ip IP) (int, Uint128) {
+
+	if ip.Is4() {
+		return 0, Uint128FromUint32(ip.AsUint32()).Lsh(96)
+	}
+	return 1, ip.AsUint128()
+}
+
+func ipt_mask(bits int) Uint128 {
+	return UINT128_MAX.Lsh(uint(128 - bits))
+}
+
+func ipt_bit(key Uint128, i int) int {
+	return int(key.Bit(127 - i))
+}
+
+func ipt_prefix(idx int, key Uint128, bits int) IPPrefix {
+
+	if idx == 0 {
+		return IPPrefixFrom(IPFromUint32(key.Rsh(96).Uint32()), bits)
+	}
+	return IPPrefixFrom(IPFromUint128(key), bits)
+}
+
+func (n *ipt_node[V]) matches(key Uint128) bool {
+	return key.Xor(n.key).And(ipt_mask(n.bits)).IsZero()
+}
+
+func (n *ipt_node[V]) clone() *ipt_node[V] {
+
+	c := *n
+	return &c
+}
+
+func (t *IPPrefixTable[V]) Len() int {
+	return t.count
+}
+
+// Returns a copy of the table which is unaffected by further updates to t.
+func (t *IPPrefixTable[V]) Snapshot() *IPPrefixTable[V] {
+
+	c := *t
+	return &c
+}
+
+// Sets the value for the prefix, replacing any previous value.
+func (t *IPPrefixTable[V]) Insert(p IPPrefix, val V) {
+
+	if p == (IPPrefix{}) {
+		panic("uninitialized")
+	}
+	idx, key := ipt_key(p.Addr())
+	var added bool
+	t.roots[idx], added = ipt_insert(t.roots[idx], key, p.Bits(), val)
+	if added {
+		t.count++
+	}
+}
+
+func (t *IPPrefixTable[V]) InsertErr(p IPPrefix, val V) error {
+
+	if p == (IPPrefix{}) {
+		return ErrUninitialized
+	}
+	t.Insert(p, val)
+	return nil
+}
+
+func ipt_insert[V any](n *ipt_node[V], key Uint128, bits int, val V) (*ipt_node[V], bool) {
+
+	if n == nil {
+		return &ipt_node[V]{key: key, bits: bits, has: true, val: val}, true
+	}
+	common := min(key.Xor(n.key).LeadingZeros(), n.bits, bits)
+	switch {
+	case common == n.bits && common == bits:
+		c := n.clone()
+		c.has = true
+		c.val = val
+		return c, !n.has
+	case common == n.bits:
+		b := ipt_bit(key, n.bits)
+		c := n.clone()
+		var added bool
+		c.child[b], added = ipt_insert(n.child[b], key, bits, val)
+		return c, added
+	case common == bits:
+		c := &ipt_node[V]{key: key, bits: bits, has: true, val: val}
+		c.child[ipt_bit(n.key, bits)] = n
+		return c, true
+	default:
+		c := &ipt_node[V]{key: key.And(ipt_mask(common)), bits: common}
+		c.child[ipt_bit(n.key, common)] = n
+		c.child[ipt_bit(key, common)] = &ipt_node[V]{key: key, bits: bits, has: true, val: val}
+		return c, true
+	}
+}
+
+// Removes the prefix from the table. Returns whether it was present.
+func (t *IPPrefixTable[V]) Delete(p IPPrefix) bool {
+
+	if p == (IPPrefix{}) {
+		return false
+	}
+	idx, key := ipt_key(p.Addr())
+	var found bool
+	t.roots[idx], found = ipt_delete(t.roots[idx], key, p.Bits())
+	if found {
+		t.count--
+	}
+	return found
+}
+
+func ipt_delete[V any](n *ipt_node[V], key Uint128, bits int) (*ipt_node[V], bool) {
+
+	if n == nil || n.bits > bits || !n.matches(key) {
+		return n, false
+	}
+	var c *ipt_node[V]
+	if n.bits == bits {
+		if !n.has {
+			return n, false
+		}
+		c = n.clone()
+		c.has = false
+		var zero V
+		c.val = zero
+	} else {
+		b := ipt_bit(key, n.bits)
+		child, found := ipt_delete(n.child[b], key, bits)
+		if !found {
+			return n, false
+		}
+		c = n.clone()
+		c.child[b] = child
+	}
+	// branch points without a value must have two children
+	if !c.has {
+		switch {
+		case c.child[0] == nil:
+			return c.child[1], true
+		case c.child[1] == nil:
+			return c.child[0], true
+		}
+	}
+	return c, true
+}
+
+// Returns the value of exactly the given prefix.
+func (t *IPPrefixTable[V]) Get(p IPPrefix) (V, bool) {
+
+	var zero V
+	if p == (IPPrefix{}) {
+		return zero, false
+	}
+	idx, key := ipt_key(p.Addr())
+	bits := p.Bits()
+	for n := t.roots[idx]; n != nil && n.bits <= bits && n.matches(key); {
+		if n.bits == bits {
+			if n.has {
+				return n.val, true
+			}
+			break
+		}
+		n = n.child[ipt_bit(key, n.bits)]
+	}
+	return zero, false
+}
+
+// Returns the value of the longest prefix containing the address.
+func (t *IPPrefixTable[V]) Lookup(ip IP) (V, bool) {
+
+	var zero V
+	if ip.IsZero() {
+		return zero, false
+	}
+	idx, key := ipt_key(ip)
+	if best := t.lookup(idx, key, 128); best != nil {
+		return best.val, true
+	}
+	return zero, false
+}
+
+// Returns the longest prefix in the table, and its value, which contains the
+// given prefix. The given prefix itself is a match if present.
+func (t *IPPrefixTable[V]) LookupPrefix(p IPPrefix) (IPPrefix, V, bool) {
+
+	var zero V
+	if p == (IPPrefix{}) {
+		return IPPrefix{}, zero, false
+	}
+	idx, key := ipt_key(p.Addr())
+	if best := t.lookup(idx, key, p.Bits()); best != nil {
+		return ipt_prefix(idx, best.key, best.bits), best.val, true
+	}
+	return IPPrefix{}, zero, false
+}
+
+func (t *IPPrefixTable[V]) lookup(idx int, key Uint128, bits int) *ipt_node[V] {
+
+	var best *ipt_node[V]
+	for n := t.roots[idx]; n != nil && n.bits <= bits && n.matches(key); {
+		if n.has {
+			best = n
+		}
+		if n.bits == 128 {
+			break
+		}
+		n = n.child[ipt_bit(key, n.bits)]
+	}
+	return best
+}
+
+// Calls fn for every prefix in the table which contains p, including p itself,
+// from the shortest to the longest, until fn returns false.
+func (t *IPPrefixTable[V]) Covering(p IPPrefix, fn func(IPPrefix, V) bool) {
+
+	if p == (IPPrefix{}) {
+		return
+	}
+	idx, key := ipt_key(p.Addr())
+	bits := p.Bits()
+	for n := t.roots[idx]; n != nil && n.bits <= bits && n.matches(key); {
+		if n.has && !fn(ipt_prefix(idx, n.key, n.bits), n.val) {
+			return
+		}
+		if n.bits == 128 {
+			break
+		}
+		n = n.child[ipt_bit(key, n.bits)]
+	}
+}
+
+// Calls fn for every prefix in the table which is contained in p, including p
+// itself, in prefix order, until fn returns false.
+func (t *IPPrefixTable[V]) CoveredBy(p IPPrefix, fn func(IPPrefix, V) bool) {
+
+	if p == (IPPrefix{}) {
+		return
+	}
+	idx, key := ipt_key(p.Addr())
+	bits := p.Bits()
+	n := t.roots[idx]
+	for n != nil && n.bits < bits {
+		if !n.matches(key) {
+			return
+		}
+		n = n.child[ipt_bit(key, n.bits)]
+	}
+	// n is the shallowest node at least as long as p
+	if n != nil && key.Xor(n.key).And(ipt_mask(bits)).IsZero() {
+		ipt_walk(idx, n, fn)
+	}
+}
+
+// Calls fn for every prefix in the table, IPv4 first, in prefix order, until fn
+// returns false. Prefix order is by address, then by length.
+func (t *IPPrefixTable[V]) Walk(fn func(IPPrefix, V) bool) {
+
+	for idx, root := range t.roots {
+		if !ipt_walk(idx, root, fn) {
+			return
+		}
+	}
+}
+
+func ipt_walk[V any](idx int, n *ipt_node[V], fn func(IPPrefix, V) bool) bool {
+
+	if n == nil {
+		return true
+	}
+	if n.has && !fn(ipt_prefix(idx, n.key, n.bits), n.val) {
+		return false
+	}
+	return ipt_walk(idx, n.child[0], fn) && ipt_walk(idx, n.child[1], fn)
+}
+
+// Holds the current snapshot of a table for concurrent readers. Readers Load()
+// the table and use it without locking. Writers apply their changes through
+// Update(), which publishes a new snapshot atomically. The zero value holds an
+// empty table.
+type IPPrefixTableAtomic[V any] struct {
+	mtx sync.Mutex // serializes writers
+	cur atomic.Pointer[IPPrefixTable[V]]
+}
+
+// Returns the current snapshot. It must not be modified.
+func (a *IPPrefixTableAtomic[V]) Load() *IPPrefixTable[V] {
+
+	if t := a.cur.Load(); t != nil {
+		return t
+	}
+	return &IPPrefixTable[V]{}
+}
+
+// Replaces the current snapshot with t. The caller must not modify t afterwards.
+func (a *IPPrefixTableAtomic[V]) Store(t *IPPrefixTable[V]) {
+
+	a.mtx.Lock()
+	a.cur.Store(t)
+	a.mtx.Unlock()
+}
+
+// Applies fn to a copy of the current snapshot, then publishes the copy.
+func (a *IPPrefixTableAtomic[V]) Update(fn func(t *IPPrefixTable[V])) {
+
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+	t := a.Load().Snapshot()
+	fn(t)
+	a.cur.Store(t)
+}
@@ -0,0 +1,143 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestIPPrefixTable(t *testing.T) {
+
+	var tbl IPPrefixTable[string]
+	for _, p := range []string{"0.0.0.0/0", "10.0.0.0/8", "10.1.0.0/16",
+		"10.1.2.0/24", "10.1.3.0/24", "::/0", "2001:db8::/32", "2001:db8:1::/48"} {
+		tbl.Insert(MustParseIPPrefix(p), p)
+	}
+
+	test_cases := []struct {
+		ip    string
+		match string
+	}{
+		{"10.1.2.3", "10.1.2.0/24"},
+		{"10.1.4.1", "10.1.0.0/16"},
+		{"10.2.0.0", "10.0.0.0/8"},
+		{"192.0.2.1", "0.0.0.0/0"},
+		{"2001:db8:1::1", "2001:db8:1::/48"},
+		{"2001:db8:2::1", "2001:db8::/32"},
+		{"::ffff:10.1.2.3", "::/0"},
+	}
+	for i, c := range test_cases {
+		val, ok := tbl.Lookup(MustParseIP(c.ip))
+		if !ok || val != c.match {
+			t.Errorf("case %v: %v: expected %v, got %v", i, c.ip, c.match, val)
+		}
+	}
+
+	snap := tbl.Snapshot()
+	if !tbl.Delete(MustParseIPPrefix("10.1.0.0/16")) {
+		t.Errorf("deleting 10.1.0.0/16 failed")
+	}
+	if tbl.Delete(MustParseIPPrefix("10.1.0.0/16")) {
+		t.Errorf("deleting 10.1.0.0/16 twice succeeded")
+	}
+	if val, _ := tbl.Lookup(MustParseIP("10.1.4.1")); val != "10.0.0.0/8" {
+		t.Errorf("unexpected match after delete: %v", val)
+	}
+	if val, _ := snap.Lookup(MustParseIP("10.1.4.1")); val != "10.1.0.0/16" {
+		t.Errorf("snapshot modified by delete: %v", val)
+	}
+	if tbl.Len() != 7 || snap.Len() != 8 {
+		t.Errorf("unexpected lengths %v %v", tbl.Len(), snap.Len())
+	}
+
+	var covering, covered []string
+	snap.Covering(MustParseIPPrefix("10.1.2.0/24"), func(p IPPrefix, _ string) bool {
+		covering = append(covering, p.String())
+		return true
+	})
+	snap.CoveredBy(MustParseIPPrefix("10.0.0.0/8"), func(p IPPrefix, _ string) bool {
+		covered = append(covered, p.String())
+		return true
+	})
+	if len(covering) != 4 || covering[0] != "0.0.0.0/0" || covering[3] != "10.1.2.0/24" {
+		t.Errorf("unexpected covering prefixes %v", covering)
+	}
+	if len(covered) != 4 || covered[0] != "10.0.0.0/8" || covered[3] != "10.1.3.0/24" {
+		t.Errorf("unexpected covered prefixes %v", covered)
+	}
+}
+
+func TestIPPrefixTableRandom(t *testing.T) {
+
+	rnd := rand.New(rand.NewSource(1))
+	var tbl IPPrefixTable[int]
+	var prefixes []IPPrefix
+	for i := 0; i < 2000; i++ {
+		p := IPPrefixFrom(IPFromUint32(rnd.Uint32() & 0xff0fff00), rnd.Intn(33))
+		tbl.Insert(p, p.Bits())
+		prefixes = append(prefixes, p)
+	}
+	for i := 0; i < 500; i++ {
+		tbl.Delete(prefixes[rnd.Intn(len(prefixes))])
+	}
+	var present []IPPrefix
+	tbl.Walk(func(p IPPrefix, _ int) bool {
+		if n := len(present); n > 0 && (present[n-1].Addr().Compare(p.Addr()) > 0 ||
+			present[n-1].Addr() == p.Addr() && present[n-1].Bits() >= p.Bits()) {
+			t.Errorf("walk out of order: %v before %v", present[n-1], p)
+		}
+		present = append(present, p)
+		return true
+	})
+	if len(present) != tbl.Len() {
+		t.Errorf("walked %v prefixes, expected %v", len(present), tbl.Len())
+	}
+	for i := 0; i < 2000; i++ {
+		ip := IPFromUint32(rnd.Uint32() & 0xff0fffff)
+		best := -1
+		for _, p := range present {
+			if p.Contains(ip) && p.Bits() > best {
+				best = p.Bits()
+			}
+		}
+		val, ok := tbl.Lookup(ip)
+		if ok != (best >= 0) || ok && val != best {
+			t.Fatalf("%v: expected /%v, got /%v (%v)", ip, best, val, ok)
+		}
+	}
+}
+
+func TestIPPrefixTableLookupAllocs(t *testing.T) {
+
+	var tbl IPPrefixTable[int]
+	tbl.Insert(MustParseIPPrefix("10.0.0.0/8"), 1)
+	tbl.Insert(MustParseIPPrefix("2001:db8::/32"), 2)
+	ip4 := MustParseIP("10.1.2.3")
+	ip6 := MustParseIP("2001:db8::1")
+	allocs := testing.AllocsPerRun(100, func() {
+		tbl.Lookup(ip4)
+		tbl.Lookup(ip6)
+	})
+	if allocs != 0 {
+		t.Errorf("lookup allocates %v times", allocs)
+	}
+}
+
+func BenchmarkIPPrefixTableLookup(b *testing.B) {
+
+	rnd := rand.New(rand.NewSource(1))
+	var tbl IPPrefixTable[int]
+	for i := 0; i < 1000000; i++ {
+		tbl.Insert(IPPrefixFrom(IPFromUint32(rnd.Uint32()), 8 + rnd.Intn(25)), i)
+	}
+	ips := make([]IP, 1024)
+	for i := range ips {
+		ips[i] = IPFromUint32(rnd.Uint32())
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tbl.Lookup(ips[i % len(ips)])
+	}
+}
@@ -0,0 +1,140 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"strings"
+)
+
+// An inclusive range of IP addresses of the same version. The zero value is
+// the empty range.
+type IPRange struct {
+	from IP
+	to   IP // Must be the same version as from, and from <= to
+}
+
+func IPRangeFrom(from, to IP) IPRange {
+
+	if from.Ver() != to.Ver() || from.Compare(to) > 0 {
+		panic("invalid IP range")
+	}
+	return IPRange{from, to}
+}
+
+func IPRangeFromChecked(from, to IP) (IPRange, error) {
+
+	if from.IsZero() || to.IsZero() {
+		return IPRange{}, ErrUninitialized
+	}
+	if from.Ver() != to.Ver() {
+		return IPRange{}, ErrIPVersionMismatch
+	}
+	if from.Compare(to) > 0 {
+		return IPRange{}, ErrInvalidRange
+	}
+	return IPRange{from, to}, nil
+}
+
+func (r IPRange) From() IP {
+	return r.from
+}
+
+func (r IPRange) To() IP {
+	return r.to
+}
+
+func (r IPRange) IsZero() bool {
+	return r == IPRange{}
+}
+
+func (r IPRange) Ver() int {
+	return r.from.Ver()
+}
+
+func (r IPRange) String() string {
+
+	if r.IsZero() {
+		return "(empty)"
+	}
+	return r.from.String() + "-" + r.to.String()
+}
+
+func ParseIPRange(s string) (IPRange, error) {
+
+	froms, tos, found := strings.Cut(s, "-")
+	if !found {
+		return IPRange{}, errors.New("invalid format (missing '-')")
+	}
+	from, err := ParseIP(strings.TrimSpace(froms))
+	if err != nil {
+		return IPRange{}, err
+	}
+	to, err := ParseIP(strings.TrimSpace(tos))
+	if err != nil {
+		return IPRange{}, err
+	}
+	if from.Ver() != to.Ver() {
+		return IPRange{}, errors.New("IP range ends are different versions")
+	}
+	if from.Compare(to) > 0 {
+		return IPRange{}, errors.New("IP range start is after its end")
+	}
+	return IPRange{from, to}, nil
+}
+
+func MustParseIPRange(s string) IPRange {
+
+	r, err := ParseIPRange(s)
+	if err != nil {
+		panic("invalid IP range")
+	}
+	return r
+}
+
+func (r IPRange) Contains(ip IP) bool {
+
+	if r.IsZero() || ip.IsZero() || ip.Ver() != r.Ver() {
+		return false
+	}
+	return r.from.Compare(ip) <= 0 && ip.Compare(r.to) <= 0
+}
+
+func (a IPRange) Overlaps(b IPRange) bool {
+
+	if a.IsZero() || b.IsZero() || a.Ver() != b.Ver() {
+		return false
+	}
+	return a.from.Compare(b.to) <= 0 && b.from.Compare(a.to) <= 0
+}
+
+// Returns the minimal list of prefixes which exactly cover the range, in order.
+func (r IPRange) Prefixes() []IPPrefix {
+
+	if r.IsZero() {
+		return nil
+	}
+	width := r.from.Len() * 8
+	from := r.from.AsUint128Cast()
+	to := r.to.AsUint128Cast()
+	prefixes := []IPPrefix{}
+	for {
+		// the largest block which starts at from and doesn't extend past to
+		diff := to.Sub(from)
+		k := 128
+		if diff != UINT128_MAX {
+			k = diff.Add(UINT128_1).BitLen() - 1
+		}
+		k = min(k, from.TrailingZeros(), width)
+		prefixes = append(prefixes, IPPrefixFrom(ip_from_uint128(r.Ver(), from), width - k))
+		if k == 128 {
+			break
+		}
+		last := from.Add(UINT128_1.Lsh(uint(k)).Sub(UINT128_1))
+		if last == to {
+			break
+		}
+		from = last.Add(UINT128_1)
+	}
+	return prefixes
+}
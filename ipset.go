@@ -0,0 +1,310 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"sort"
+	"strings"
+)
+
+// An immutable set of IPv4 and IPv6 addresses. The zero value is the empty set.
+// Use IPSetBuilder to construct one.
+type IPSet struct {
+	ranges []IPRange // sorted, non-overlapping and non-adjacent
+}
+
+// Accumulates additions and removals for an IPSet. The zero value is an empty
+// builder, ready to use.
+type IPSetBuilder struct {
+	ranges []IPRange
+	sorted bool // ranges are normalized
+}
+
+func (b *IPSetBuilder) AddIP(ip IP) {
+	b.AddRange(IPRange{ip, ip})
+}
+
+func (b *IPSetBuilder) AddPrefix(p IPPrefix) {
+	b.AddRange(p.Range())
+}
+
+func (b *IPSetBuilder) AddRange(r IPRange) {
+
+	if r.IsZero() {
+		return
+	}
+	b.ranges = append(b.ranges, r)
+	b.sorted = false
+}
+
+func (b *IPSetBuilder) AddSet(s IPSet) {
+
+	if len(s.ranges) == 0 {
+		return
+	}
+	b.ranges = append(b.ranges, s.ranges...)
+	b.sorted = false
+}
+
+func (b *IPSetBuilder) RemoveIP(ip IP) {
+	b.RemoveRange(IPRange{ip, ip})
+}
+
+func (b *IPSetBuilder) RemovePrefix(p IPPrefix) {
+	b.RemoveRange(p.Range())
+}
+
+func (b *IPSetBuilder) RemoveRange(r IPRange) {
+
+	if r.IsZero() {
+		return
+	}
+	b.normalize()
+	ranges := b.ranges[:0:0]
+	for _, x := range b.ranges {
+		ranges = append(ranges, ip_range_subtract(x, r)...)
+	}
+	b.ranges = ranges
+}
+
+func (b *IPSetBuilder) RemoveSet(s IPSet) {
+
+	for _, r := range s.ranges {
+		b.RemoveRange(r)
+	}
+}
+
+// Returns the set of addresses added so far, minus those removed. The builder
+// may continue to be used afterwards.
+func (b *IPSetBuilder) IPSet() IPSet {
+
+	b.normalize()
+	ranges := make([]IPRange, len(b.ranges))
+	copy(ranges, b.ranges)
+	return IPSet{ranges}
+}
+
+func (b *IPSetBuilder) normalize() {
+
+	if b.sorted {
+		return
+	}
+	b.ranges = normalize_ip_ranges(b.ranges)
+	b.sorted = true
+}
+
+func normalize_ip_ranges(ranges []IPRange) []IPRange {
+
+	if len(ranges) == 0 {
+		return nil
+	}
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from.Compare(ranges[j].from) < 0
+	})
+	res := ranges[:1]
+	for _, r := range ranges[1:] {
+		last := &res[len(res) - 1]
+		if last.Ver() == r.Ver() {
+			next, err := last.to.Next()
+			if err != nil || r.from.Compare(next) <= 0 {
+				if r.to.Compare(last.to) > 0 {
+					last.to = r.to
+				}
+				continue
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Returns the parts of a which aren't in b, in order.
+func ip_range_subtract(a, b IPRange) []IPRange {
+
+	if !a.Overlaps(b) {
+		return []IPRange{a}
+	}
+	var res []IPRange
+	if a.from.Compare(b.from) < 0 {
+		to, _ := b.from.Prev()
+		res = append(res, IPRange{a.from, to})
+	}
+	if b.to.Compare(a.to) < 0 {
+		from, _ := b.to.Next()
+		res = append(res, IPRange{from, a.to})
+	}
+	return res
+}
+
+func IPSetFromPrefixes(prefixes []IPPrefix) IPSet {
+
+	var b IPSetBuilder
+	for _, p := range prefixes {
+		b.AddPrefix(p)
+	}
+	return b.IPSet()
+}
+
+func IPSetFromRanges(ranges []IPRange) IPSet {
+
+	var b IPSetBuilder
+	for _, r := range ranges {
+		b.AddRange(r)
+	}
+	return b.IPSet()
+}
+
+func (s IPSet) IsEmpty() bool {
+	return len(s.ranges) == 0
+}
+
+// Returns the ranges of the set, in order, IPv4 first.
+func (s IPSet) Ranges() []IPRange {
+
+	ranges := make([]IPRange, len(s.ranges))
+	copy(ranges, s.ranges)
+	return ranges
+}
+
+// Returns the minimal list of prefixes which cover the set, in order.
+func (s IPSet) Prefixes() []IPPrefix {
+
+	var prefixes []IPPrefix
+	for _, r := range s.ranges {
+		prefixes = append(prefixes, r.Prefixes()...)
+	}
+	return prefixes
+}
+
+func (s IPSet) Contains(ip IP) bool {
+
+	if ip.IsZero() {
+		return false
+	}
+	_, ok := s.range_containing(ip)
+	return ok
+}
+
+func (s IPSet) range_containing(ip IP) (IPRange, bool) {
+
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return ip.Compare(s.ranges[i].to) <= 0
+	})
+	if i < len(s.ranges) && s.ranges[i].Contains(ip) {
+		return s.ranges[i], true
+	}
+	return IPRange{}, false
+}
+
+func (s IPSet) ContainsRange(r IPRange) bool {
+
+	if r.IsZero() {
+		return false
+	}
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return r.from.Compare(s.ranges[i].to) <= 0
+	})
+	return i < len(s.ranges) && s.ranges[i].Contains(r.from) &&
+		s.ranges[i].Contains(r.to)
+}
+
+func (s IPSet) ContainsPrefix(p IPPrefix) bool {
+	return s.ContainsRange(p.Range())
+}
+
+func (s IPSet) OverlapsRange(r IPRange) bool {
+
+	if r.IsZero() {
+		return false
+	}
+	i := sort.Search(len(s.ranges), func(i int) bool {
+		return r.from.Compare(s.ranges[i].to) <= 0
+	})
+	return i < len(s.ranges) && s.ranges[i].Overlaps(r)
+}
+
+func (s IPSet) OverlapsPrefix(p IPPrefix) bool {
+	return s.OverlapsRange(p.Range())
+}
+
+func (a IPSet) Equal(b IPSet) bool {
+
+	if len(a.ranges) != len(b.ranges) {
+		return false
+	}
+	for i := range a.ranges {
+		if a.ranges[i] != b.ranges[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (a IPSet) Union(b IPSet) IPSet {
+
+	var bld IPSetBuilder
+	bld.AddSet(a)
+	bld.AddSet(b)
+	return bld.IPSet()
+}
+
+func (a IPSet) Intersect(b IPSet) IPSet {
+
+	var ranges []IPRange
+	i, j := 0, 0
+	for i < len(a.ranges) && j < len(b.ranges) {
+		x, y := a.ranges[i], b.ranges[j]
+		if x.Overlaps(y) {
+			from, to := x.from, x.to
+			if y.from.Compare(from) > 0 {
+				from = y.from
+			}
+			if y.to.Compare(to) < 0 {
+				to = y.to
+			}
+			ranges = append(ranges, IPRange{from, to})
+		}
+		if x.to.Compare(y.to) < 0 {
+			i++
+		} else {
+			j++
+		}
+	}
+	return IPSet{ranges}
+}
+
+func (a IPSet) Subtract(b IPSet) IPSet {
+
+	var bld IPSetBuilder
+	bld.AddSet(a)
+	bld.RemoveSet(b)
+	return bld.IPSet()
+}
+
+// Returns all addresses of the given IP version which are not in the set.
+// Addresses of the other version are not included. If ipver is neither 4 nor
+// 6, the result is empty.
+func (s IPSet) Complement(ipver int) IPSet {
+
+	if IPVerToLen(ipver) == 0 {
+		return IPSet{}
+	}
+	all := IPPrefixAllVer(ipver).Range()
+	var bld IPSetBuilder
+	bld.AddRange(all)
+	for _, r := range s.ranges {
+		if r.Ver() == ipver {
+			bld.RemoveRange(r)
+		}
+	}
+	return bld.IPSet()
+}
+
+func (s IPSet) String() string {
+
+	ss := make([]string, len(s.ranges))
+	for i, r := range s.ranges {
+		ss[i] = r.String()
+	}
+	return "{" + strings.Join(ss, ", ") + "}"
+}
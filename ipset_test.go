@@ -0,0 +1,144 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "testing"
+
+func TestIPRangePrefixes(t *testing.T) {
+
+	test_cases := []struct {
+		rng      string
+		prefixes []string
+	}{
+		{"10.0.0.10-10.0.0.200", []string{"10.0.0.10/31", "10.0.0.12/30",
+			"10.0.0.16/28", "10.0.0.32/27", "10.0.0.64/26", "10.0.0.128/26",
+			"10.0.0.192/29", "10.0.0.200/32"}},
+		{"10.0.0.0-10.0.0.255", []string{"10.0.0.0/24"}},
+		{"0.0.0.0-255.255.255.255", []string{"0.0.0.0/0"}},
+		{":: - ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff", []string{"::/0"}},
+		{"2001:db8::1-2001:db8::2", []string{"2001:db8::1/128", "2001:db8::2/128"}},
+		{"255.255.255.255-255.255.255.255", []string{"255.255.255.255/32"}},
+	}
+
+	for i, c := range test_cases {
+
+		r := MustParseIPRange(c.rng)
+		prefixes := r.Prefixes()
+		if len(prefixes) != len(c.prefixes) {
+			t.Errorf("case %v: expected %v, got %v", i, c.prefixes, prefixes)
+			continue
+		}
+		for j := range prefixes {
+			if prefixes[j] != MustParseIPPrefix(c.prefixes[j]) {
+				t.Errorf("case %v: expected %v, got %v", i, c.prefixes, prefixes)
+				break
+			}
+		}
+	}
+}
+
+func TestIPSet(t *testing.T) {
+
+	var b IPSetBuilder
+	b.AddPrefix(MustParseIPPrefix("10.0.0.0/16"))
+	b.RemovePrefix(MustParseIPPrefix("10.0.1.0/24"))
+	b.RemovePrefix(MustParseIPPrefix("10.0.3.0/24"))
+	b.AddRange(MustParseIPRange("2001:db8::-2001:db8::ff"))
+	b.AddRange(MustParseIPRange("2001:db8::100-2001:db8::1ff"))
+	s := b.IPSet()
+
+	expected := "{10.0.0.0-10.0.0.255, 10.0.2.0-10.0.2.255, 10.0.4.0-10.0.255.255, " +
+		"2001:db8::-2001:db8::1ff}"
+	if s.String() != expected {
+		t.Errorf("expected %v, got %v", expected, s)
+	}
+	for _, c := range []struct {
+		ip       string
+		contains bool
+	}{
+		{"10.0.0.5", true},
+		{"10.0.1.5", false},
+		{"10.0.2.255", true},
+		{"10.0.3.0", false},
+		{"10.0.255.255", true},
+		{"10.1.0.0", false},
+		{"2001:db8::180", true},
+		{"2001:db8::200", false},
+		{"::ffff:10.0.0.5", false},
+	} {
+		if s.Contains(MustParseIP(c.ip)) != c.contains {
+			t.Errorf("%v: expected contains %v", c.ip, c.contains)
+		}
+	}
+
+	other := IPSetFromPrefixes([]IPPrefix{MustParseIPPrefix("10.0.0.128/25"),
+		MustParseIPPrefix("10.0.3.0/24")})
+	if x := s.Intersect(other).String(); x != "{10.0.0.128-10.0.0.255}" {
+		t.Errorf("unexpected intersection %v", x)
+	}
+	if !s.Union(other).ContainsPrefix(MustParseIPPrefix("10.0.2.0/23")) {
+		t.Errorf("union does not contain 10.0.2.0/23")
+	}
+	expected = "{0.0.0.0-9.255.255.255, 10.0.1.0-10.0.1.255, 10.0.3.0-10.0.3.255, " +
+		"10.1.0.0-255.255.255.255}"
+	if x := s.Complement(4).String(); x != expected {
+		t.Errorf("unexpected complement %v", x)
+	}
+	if !s.Complement(6).Complement(6).Equal(IPSetFromRanges(s.Ranges()[3:])) {
+		t.Errorf("double complement is not the identity")
+	}
+	if !s.Complement(5).IsEmpty() {
+		t.Errorf("expected empty complement for invalid IP version")
+	}
+}
+
+func TestIPPrefixAlgebra(t *testing.T) {
+
+	prefixes := func(ss ...string) []IPPrefix {
+		var ps []IPPrefix
+		for _, s := range ss {
+			ps = append(ps, MustParseIPPrefix(s))
+		}
+		return ps
+	}
+	equal := func(a, b []IPPrefix) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	a := MustParseIPPrefix("10.0.0.0/22")
+	b := MustParseIPPrefix("10.0.2.128/25")
+	if !a.ContainsPrefix(b) || b.ContainsPrefix(a) || !a.Overlaps(b) {
+		t.Errorf("unexpected containment of %v and %v", a, b)
+	}
+	if a.Overlaps(MustParseIPPrefix("10.0.4.0/22")) {
+		t.Errorf("adjacent prefixes overlap")
+	}
+	if s := b.Supernet(22); s != a {
+		t.Errorf("unexpected supernet %v", s)
+	}
+	if l := a.Last(); l != MustParseIP("10.0.3.255") {
+		t.Errorf("unexpected last address %v", l)
+	}
+	expected := prefixes("10.0.0.0/23", "10.0.2.0/25", "10.0.3.0/24")
+	if s := a.Subtract(b); !equal(s, expected) {
+		t.Errorf("expected %v, got %v", expected, s)
+	}
+	if s := b.Subtract(a); len(s) != 0 {
+		t.Errorf("expected empty difference, got %v", s)
+	}
+
+	agg := AggregatePrefixes(prefixes("10.0.1.0/24", "10.0.0.0/24", "10.0.0.128/25",
+		"10.0.2.0/24", "2001:db8::/33", "2001:db8:8000::/33"))
+	expected = prefixes("10.0.0.0/23", "10.0.2.0/24", "2001:db8::/32")
+	if !equal(agg, expected) {
+		t.Errorf("expected %v, got %v", expected, agg)
+	}
+}
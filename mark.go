@@ -0,0 +1,240 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+ * Every mapping in gw is owned by an OID, and carries the mark at which it was
+ * set. Marks are seconds since the time base, saved with V1_SAVE_TIME_BASE.
+ * When an owner sets a new mark with V1_SET_MARK, its mappings with earlier
+ * marks expire. Marks wrap around, and are compared within half their range.
+ */
+
+type OID uint32
+
+type Mark uint32
+
+// Unix time, in seconds, of mark zero
+type TimeBase int64
+
+var ErrOIDRegistryFull = errors.New("OID registry full")
+
+func NewTimeBase(t time.Time) TimeBase {
+	return TimeBase(t.Unix())
+}
+
+func (tb TimeBase) Time() time.Time {
+	return time.Unix(int64(tb), 0).UTC()
+}
+
+// Returns the mark at the time, truncated to seconds. Times before the time
+// base, or over the mark range after it, wrap around.
+func (tb TimeBase) Mark(t time.Time) Mark {
+	return Mark(t.Unix() - int64(tb))
+}
+
+// Returns the time of the mark, assuming it is at most half the mark range
+// away from ref.
+func (tb TimeBase) MarkTime(m Mark, ref time.Time) time.Time {
+	return ref.Truncate(time.Second).Add(m.Sub(tb.Mark(ref))).UTC()
+}
+
+func (tb TimeBase) Now() Mark {
+	return tb.Mark(time.Now())
+}
+
+func (a Mark) After(b Mark) bool {
+	return int32(a - b) > 0
+}
+
+func (a Mark) Before(b Mark) bool {
+	return int32(a - b) < 0
+}
+
+func (a Mark) Compare(b Mark) int {
+
+	switch d := int32(a - b); {
+	case d < 0:
+		return -1
+	case d > 0:
+		return 1
+	}
+	return 0
+}
+
+// Returns the mark d later, in whole seconds.
+func (m Mark) Add(d time.Duration) Mark {
+	return m + Mark(int64(d / time.Second))
+}
+
+// Returns the time from b to a, negative if a is before b.
+func (a Mark) Sub(b Mark) time.Duration {
+	return time.Duration(int32(a - b)) * time.Second
+}
+
+// The oid + mark pair of V1 payloads, V1_MARK_LEN bytes
+type OIDMark struct {
+	OID  OID
+	Mark Mark
+}
+
+func (om OIDMark) AppendV1(dst []byte) []byte {
+
+	dst = be.AppendUint32(dst, uint32(om.OID))
+	return be.AppendUint32(dst, uint32(om.Mark))
+}
+
+func DecodeOIDMark(src []byte) (OIDMark, error) {
+
+	if len(src) < V1_MARK_LEN {
+		return OIDMark{}, ErrShortBuffer
+	}
+	return OIDMark{OID(be.Uint32(src[V1_OID:])), Mark(be.Uint32(src[V1_MARK:]))}, nil
+}
+
+// Maps owner names to OIDs, allocated from 1 up. If it has a path, the registry
+// is loaded from it, and saved to it after every allocation, so owners keep
+// their OIDs across restarts. Safe for concurrent use.
+type OIDRegistry struct {
+	mu    sync.Mutex
+	path  string
+	oids  map[string]OID
+	names map[OID]string
+	last  OID
+}
+
+type oid_registry_file struct {
+	OIDs map[string]OID `json:"oids"`
+}
+
+// Opens the registry saved at path, or creates an empty one if there is no
+// file. An empty path means an in-memory registry.
+func OpenOIDRegistry(path string) (*OIDRegistry, error) {
+
+	r := &OIDRegistry{path: path, oids: make(map[string]OID), names: make(map[OID]string)}
+	if path == "" {
+		return r, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return r, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f oid_registry_file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	for name, oid := range f.OIDs {
+		if oid == 0 {
+			return nil, errors.New("OID registry has zero OID for " + name)
+		}
+		if _, ok := r.names[oid]; ok {
+			return nil, errors.New("OID registry has duplicate OID for " + name)
+		}
+		r.oids[name] = oid
+		r.names[oid] = name
+		r.last = max(r.last, oid)
+	}
+	return r, nil
+}
+
+// Returns the OID of the owner, allocating and saving a new one if needed.
+func (r *OIDRegistry) OID(name string) (OID, error) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if oid, ok := r.oids[name]; ok {
+		return oid, nil
+	}
+	oid := r.last + 1
+	for ; oid != r.last; oid++ {
+		if _, ok := r.names[oid]; !ok && oid != 0 {
+			break
+		}
+	}
+	if oid == r.last {
+		return 0, ErrOIDRegistryFull
+	}
+	r.oids[name] = oid
+	r.names[oid] = name
+	prev := r.last
+	r.last = oid
+	if err := r.save(); err != nil {
+		delete(r.oids, name)
+		delete(r.names, oid)
+		r.last = prev
+		return 0, err
+	}
+	return oid, nil
+}
+
+func (r *OIDRegistry) Lookup(name string) (OID, bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	oid, ok := r.oids[name]
+	return oid, ok
+}
+
+func (r *OIDRegistry) Name(oid OID) (string, bool) {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	name, ok := r.names[oid]
+	return name, ok
+}
+
+// Returns the owner names, sorted by OID.
+func (r *OIDRegistry) Names() []string {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.oids))
+	for name := range r.oids {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return r.oids[names[i]] < r.oids[names[j]]
+	})
+	return names
+}
+
+// Writes the registry to a temporary file, then renames it over the path.
+func (r *OIDRegistry) save() error {
+
+	if r.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(oid_registry_file{r.oids}, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(r.path), filepath.Base(r.path) + ".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
@@ -0,0 +1,101 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMark(t *testing.T) {
+
+	tb := NewTimeBase(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	now := time.Date(2025, 3, 1, 12, 30, 15, 500, time.UTC)
+	m := tb.Mark(now)
+	if m != Mark(now.Unix() - 1735689600) {
+		t.Errorf("unexpected mark %v", m)
+	}
+	if x := tb.MarkTime(m, now); !x.Equal(now.Truncate(time.Second)) {
+		t.Errorf("expected %v, got %v", now.Truncate(time.Second), x)
+	}
+	if x := tb.MarkTime(m.Add(time.Hour), now); !x.Equal(now.Truncate(time.Second).Add(time.Hour)) {
+		t.Errorf("unexpected time of later mark %v", x)
+	}
+	if !tb.Time().Equal(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time base %v", tb.Time())
+	}
+
+	test_cases := []struct {
+		a, b Mark
+		cmp  int
+	}{
+		{1, 2, -1},
+		{2, 2, 0},
+		{3, 2, 1},
+		{5, 0xfffffff0, 1}, // wrapped
+		{0xfffffff0, 5, -1},
+	}
+	for _, c := range test_cases {
+		if c.a.Compare(c.b) != c.cmp || c.a.After(c.b) != (c.cmp > 0) || c.a.Before(c.b) != (c.cmp < 0) {
+			t.Errorf("unexpected comparison of %v and %v", c.a, c.b)
+		}
+	}
+	if d := Mark(5).Sub(0xfffffff0); d != 21 * time.Second {
+		t.Errorf("unexpected wrapped difference %v", d)
+	}
+
+	om := OIDMark{7, 0x01020304}
+	enc := om.AppendV1(nil)
+	if len(enc) != V1_MARK_LEN || enc[3] != 7 || enc[V1_MARK] != 1 {
+		t.Errorf("unexpected encoding % x", enc)
+	}
+	if x, err := DecodeOIDMark(enc); err != nil || x != om {
+		t.Errorf("expected %v, got %v %v", om, x, err)
+	}
+	if _, err := DecodeOIDMark(enc[:7]); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("expected ErrShortBuffer, got %v", err)
+	}
+}
+
+func TestOIDRegistry(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "oids.json")
+	r, err := OpenOIDRegistry(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	mapper, _ := r.OID("mapper")
+	agent, _ := r.OID("dns-agent")
+	if mapper != 1 || agent != 2 {
+		t.Errorf("unexpected OIDs %v %v", mapper, agent)
+	}
+	if oid, _ := r.OID("mapper"); oid != mapper {
+		t.Errorf("expected the same OID again, got %v", oid)
+	}
+
+	r, err = OpenOIDRegistry(path)
+	if err != nil {
+		t.Fatalf("unexpected error reopening: %v", err)
+	}
+	if oid, ok := r.Lookup("dns-agent"); !ok || oid != agent {
+		t.Errorf("dns-agent OID not persisted: %v %v", oid, ok)
+	}
+	if name, ok := r.Name(mapper); !ok || name != "mapper" {
+		t.Errorf("unexpected name %v %v", name, ok)
+	}
+	if oid, _ := r.OID("resolver"); oid != 3 {
+		t.Errorf("expected next OID 3, got %v", oid)
+	}
+	if names := r.Names(); !reflect.DeepEqual(names, []string{"mapper", "dns-agent", "resolver"}) {
+		t.Errorf("unexpected names %v", names)
+	}
+
+	os.WriteFile(path, []byte(`{"oids": {"a": 1, "b": 1}}`), 0644)
+	if _, err := OpenOIDRegistry(path); err == nil {
+		t.Errorf("expected error for duplicate OIDs")
+	}
+}
@@ -0,0 +1,102 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "errors"
+
+/*
+ * IPv4-embedded IPv6 addresses per RFC 6052. The IPv4 address follows the
+ * prefix, skipping bits 64..71 (the "u" octet), which must be zero. The bits
+ * after the IPv4 address (the suffix) are zero.
+ */
+
+var NAT64_WKP = MustParseIPPrefix("64:ff9b::/96")     // well-known prefix, RFC 6052
+var NAT64_LOCAL = MustParseIPPrefix("64:ff9b:1::/48") // local-use prefix, RFC 8215
+
+var (
+	ErrInvalidNAT64Prefix = errors.New("NAT64 prefix must be IPv6 /32, /40, /48, /56, /64 or /96")
+	ErrNotInPrefix        = errors.New("IP address is not in the prefix")
+	ErrNAT64NonGlobal     = errors.New("well-known NAT64 prefix may not embed a non-global IPv4 address")
+	ErrNAT64UOctet        = errors.New("NAT64 prefix or address has non-zero u octet")
+	ErrNAT64Suffix        = errors.New("NAT64 address has non-zero suffix")
+)
+
+func nat64_check_prefix(prefix IPPrefix) error {
+
+	if prefix == (IPPrefix{}) || !prefix.Addr().Is6() {
+		return ErrInvalidNAT64Prefix
+	}
+	switch prefix.Bits() {
+	case 32, 40, 48, 56, 64, 96:
+	default:
+		return ErrInvalidNAT64Prefix
+	}
+	if prefix.Addr().AsUint128().AsBytesBE()[8] != 0 {
+		return ErrNAT64UOctet // only a /96 prefix can cover it
+	}
+	return nil
+}
+
+// Returns the IPv6 address which embeds the IPv4 address in the NAT64 prefix.
+func EmbedIPv4(prefix IPPrefix, v4 IP) (IP, error) {
+
+	if err := nat64_check_prefix(prefix); err != nil {
+		return IP{}, err
+	}
+	if v4.IsZero() {
+		return IP{}, ErrUninitialized
+	}
+	if !v4.Is4() {
+		return IP{}, ErrNotIPv4
+	}
+	if prefix == NAT64_WKP && !v4.Class().IsGlobal() {
+		return IP{}, ErrNAT64NonGlobal
+	}
+	bs := prefix.Addr().AsUint128().AsBytesBE()
+	v4b := v4.AsUint128Cast().AsBytesBE()
+	i := prefix.Bits() / 8
+	for _, b := range v4b[12:] {
+		if i == 8 {
+			i++ // skip the u octet
+		}
+		bs[i] = b
+		i++
+	}
+	return IPFromSlice(bs[:]), nil
+}
+
+// Returns the IPv4 address embedded in the IPv6 address under the NAT64 prefix.
+func ExtractIPv4(prefix IPPrefix, v6 IP) (IP, error) {
+
+	if err := nat64_check_prefix(prefix); err != nil {
+		return IP{}, err
+	}
+	if v6.IsZero() {
+		return IP{}, ErrUninitialized
+	}
+	if !v6.Is6() {
+		return IP{}, ErrNotIPv6
+	}
+	if !prefix.Contains(v6) {
+		return IP{}, ErrNotInPrefix
+	}
+	bs := v6.AsUint128().AsBytesBE()
+	if prefix.Bits() <= 64 && bs[8] != 0 {
+		return IP{}, ErrNAT64UOctet
+	}
+	var v4b [4]byte
+	i := prefix.Bits() / 8
+	for j := range v4b {
+		if i == 8 {
+			i++
+		}
+		v4b[j] = bs[i]
+		i++
+	}
+	for _, b := range bs[i:] {
+		if b != 0 {
+			return IP{}, ErrNAT64Suffix
+		}
+	}
+	return IPFromSlice(v4b[:]), nil
+}
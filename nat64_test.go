@@ -0,0 +1,58 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "testing"
+
+func TestNAT64(t *testing.T) {
+
+	// RFC 6052 section 2.4
+	v4 := MustParseIP("192.0.2.33")
+	for _, c := range []struct {
+		prefix string
+		v6     string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::"},
+		{"2001:db8:100::/40", "2001:db8:1c0:2:21::"},
+		{"2001:db8:122::/48", "2001:db8:122:c000:2:2100::"},
+		{"2001:db8:122:300::/56", "2001:db8:122:3c0:0:221::"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:0"},
+		{"2001:db8:122:344::/96", "2001:db8:122:344::192.0.2.33"},
+	} {
+		prefix := MustParseIPPrefix(c.prefix)
+		v6, err := EmbedIPv4(prefix, v4)
+		if err != nil || v6 != MustParseIP(c.v6) {
+			t.Errorf("%v: expected %v, got %v %v", c.prefix, c.v6, v6, err)
+		}
+		if x, err := ExtractIPv4(prefix, MustParseIP(c.v6)); err != nil || x != v4 {
+			t.Errorf("%v: extracted %v %v", c.prefix, x, err)
+		}
+	}
+	if _, err := EmbedIPv4(NAT64_WKP, MustParseIP("10.0.0.1")); err != ErrNAT64NonGlobal {
+		t.Errorf("expected ErrNAT64NonGlobal, got %v", err)
+	}
+	if _, err := EmbedIPv4(MustParseIPPrefix("2001:db8::/36"), v4); err != ErrInvalidNAT64Prefix {
+		t.Errorf("expected ErrInvalidNAT64Prefix, got %v", err)
+	}
+	if _, err := ExtractIPv4(MustParseIPPrefix("2001:db8::/32"), MustParseIP("2001:db8:c000:221:100::")); err != ErrNAT64UOctet {
+		t.Errorf("expected ErrNAT64UOctet, got %v", err)
+	}
+	uprefix := MustParseIPPrefix("2001:db8:122:344:100::/96")
+	if _, err := EmbedIPv4(uprefix, v4); err != ErrNAT64UOctet {
+		t.Errorf("expected ErrNAT64UOctet embedding, got %v", err)
+	}
+	if _, err := ExtractIPv4(uprefix, MustParseIP("2001:db8:122:344:100::192.0.2.33")); err != ErrNAT64UOctet {
+		t.Errorf("expected ErrNAT64UOctet extracting, got %v", err)
+	}
+	for _, c := range []struct {
+		prefix string
+		v6     string
+	}{
+		{"2001:db8::/32", "2001:db8:c000:221::1"},
+		{"2001:db8:122:344::/64", "2001:db8:122:344:c0:2:2100:100"},
+	} {
+		if _, err := ExtractIPv4(MustParseIPPrefix(c.prefix), MustParseIP(c.v6)); err != ErrNAT64Suffix {
+			t.Errorf("%v: expected ErrNAT64Suffix, got %v", c.v6, err)
+		}
+	}
+}
@@ -2,7 +2,10 @@
 
 package newv1
 
-import . "github.com/ipref/ref"
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/oldv1"
+)
 
 const ( // v1 constants
 
@@ -71,6 +74,18 @@ func AddrRecEncode(arecb []byte, arec AddrRec) int {
 	return length
 }
 
+func AddrRecEncodeErr(arecb []byte, arec AddrRec) (int, error) {
+
+	length, err := AddrRecEncodedLenOfErr(arec)
+	if err != nil {
+		return 0, err
+	}
+	if len(arecb) < length {
+		return 0, ErrShortBuffer
+	}
+	return AddrRecEncode(arecb, arec), nil
+}
+
 func AddrRecEncodedLenOf(arec AddrRec) int {
 
 	if arec.EA.Len() != arec.IP.Len() {
@@ -79,6 +94,14 @@ func AddrRecEncodedLenOf(arec AddrRec) int {
 	return AddrRecEncodedLen(arec.EA.Len(), arec.GW.Len())
 }
 
+func AddrRecEncodedLenOfErr(arec AddrRec) (int, error) {
+
+	if err := arec.CheckEncodable(); err != nil {
+		return 0, err
+	}
+	return AddrRecEncodedLenOf(arec), nil
+}
+
 func AddrRecAsSlice(arec AddrRec) []byte {
 
 	arecb := make([]byte, AddrRecEncodedLenOf(arec))
@@ -86,6 +109,14 @@ func AddrRecAsSlice(arec AddrRec) []byte {
 	return arecb
 }
 
+func AddrRecAsSliceErr(arec AddrRec) ([]byte, error) {
+
+	if err := arec.CheckEncodable(); err != nil {
+		return nil, err
+	}
+	return AddrRecAsSlice(arec), nil
+}
+
 func AddrRecDecode(arecb []byte) (bool, int, AddrRec) {
 
 	ok, _, ea_iplen, gw_iplen := AddrRecCheck(arecb)
@@ -100,3 +131,76 @@ func AddrRecDecode(arecb []byte) (bool, int, AddrRec) {
 		Ref: Ref(Uint128FromBytesBE(refb)),
 	}
 }
+
+// Registers V1_TYPE_AREC items, which carry one addrrec in the newv1 format.
+func init() {
+
+	RegisterV1Item(V1_TYPE_AREC, V1ItemType{
+		Name: "AREC",
+		Encode: func(dst []byte, val any) ([]byte, error) {
+			arec, ok := val.(AddrRec)
+			if !ok {
+				return dst, ErrV1ItemValue
+			}
+			arecb, err := AddrRecAsSliceErr(arec)
+			return append(dst, arecb...), err
+		},
+		Decode: func(val []byte) (any, error) {
+			ok, length, arec := AddrRecDecode(val)
+			if !ok || length != len(val) {
+				return nil, ErrV1Malformed
+			}
+			return arec, nil
+		},
+	})
+}
+
+// Implements AddrRecCodec for the newv1 format
+type Codec struct{}
+
+func (Codec) Name() string {
+	return "newv1"
+}
+
+func (Codec) EncodedLen(arec AddrRec) (int, error) {
+	return AddrRecEncodedLenOfErr(arec)
+}
+
+func (Codec) Encode(dst []byte, arec AddrRec) (int, error) {
+	return AddrRecEncodeErr(dst, arec)
+}
+
+func (Codec) Decode(hdr, src []byte) (int, AddrRec, error) {
+
+	if len(src) < V1_AREC_MIN_LEN {
+		return 0, AddrRec{}, ErrShortBuffer
+	}
+	ok, length, arec := AddrRecDecode(src)
+	if !ok {
+		return 0, AddrRec{}, ErrV1Malformed
+	}
+	return length, arec, nil
+}
+
+func (Codec) SetHeader(hdr []byte, arec AddrRec) error {
+
+	if len(hdr) < V1_HDR_LEN {
+		return ErrShortBuffer
+	}
+	if err := arec.CheckEncodable(); err != nil {
+		return err
+	}
+	hdr[V1_RESERVED] = 0
+	hdr[V1_RESERVED + 1] = 0
+	return nil
+}
+
+// Rewrites an oldv1 packet in the newv1 format.
+func FromOldV1(pkt []byte) ([]byte, error) {
+	return ConvertV1Packet(pkt, oldv1.Codec{}, Codec{})
+}
+
+// Rewrites a newv1 packet in the oldv1 format.
+func ToOldV1(pkt []byte) ([]byte, error) {
+	return ConvertV1Packet(pkt, Codec{}, oldv1.Codec{})
+}
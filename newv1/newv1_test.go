@@ -0,0 +1,75 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package newv1
+
+import (
+	"bytes"
+	"encoding/binary"
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/oldv1"
+	"testing"
+)
+
+var _ AddrRecCodec = Codec{}
+var _ AddrRecCodec = oldv1.Codec{}
+
+func TestConvertV1Packet(t *testing.T) {
+
+	arecs := []AddrRec{
+		MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=198.51.100.1 ref=1-2"),
+		MustParseAddrRec("ea=10.240.0.6 ip=192.0.2.2 gw=198.51.100.1 ref=3"),
+	}
+	// oldv1 V1_SET_AREC: header, oid + mark, addrrecs
+	old := []byte{V1_SIG, V1_SET_AREC, 0, 7, 0x44, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 2}
+	for _, arec := range arecs {
+		arecb := make([]byte, oldv1.AddrRecEncodedLenOf(arec))
+		oldv1.AddrRecEncode(arecb, arec)
+		old = append(old, arecb...)
+	}
+	binary.BigEndian.PutUint16(old[V1_PKTLEN:], uint16(len(old) / 4))
+
+	pkt, err := FromOldV1(old)
+	if err != nil {
+		t.Fatalf("converting to newv1: %v", err)
+	}
+	if len(pkt) != len(old) + 8 || int(binary.BigEndian.Uint16(pkt[V1_PKTLEN:])) * 4 != len(pkt) {
+		t.Errorf("unexpected newv1 packet length %v", len(pkt))
+	}
+	if pkt[V1_RESERVED] != 0 || !bytes.Equal(pkt[V1_HDR_LEN:V1_HDR_LEN + V1_MARK_LEN],
+		old[V1_HDR_LEN:V1_HDR_LEN + V1_MARK_LEN]) {
+		t.Errorf("unexpected newv1 header or mark: % x", pkt[:V1_HDR_LEN + V1_MARK_LEN])
+	}
+	i := V1_HDR_LEN + V1_MARK_LEN
+	for _, arec := range arecs {
+		ok, length, x := AddrRecDecode(pkt[i:])
+		if !ok || x != arec {
+			t.Errorf("expected %v, got %v", arec, x)
+		}
+		i += length
+	}
+
+	back, err := ToOldV1(pkt)
+	if err != nil || !bytes.Equal(back, old) {
+		t.Errorf("round trip failed: %v\n% x\n% x", err, old, back)
+	}
+	if _, err := FromOldV1(old[:len(old) - 4]); err == nil {
+		t.Errorf("expected error converting truncated packet")
+	}
+}
+
+func TestAddrRecItem(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=fd00::5 ip=2001:db8::1 gw=8.8.4.4 ref=1-2")
+	enc, err := AppendV1Item(nil, V1_TYPE_AREC, arec)
+	if err != nil || len(enc) % 4 != 0 || enc[1] != byte(AddrRecEncodedLenOf(arec)) {
+		t.Fatalf("unexpected encoding % x %v", enc, err)
+	}
+	typ, val, n, err := DecodeV1Item(enc)
+	if err != nil || typ != V1_TYPE_AREC || n != len(enc) || val != arec {
+		t.Errorf("expected %v, got %v %v %v %v", arec, typ, val, n, err)
+	}
+	enc[1]--
+	if _, _, _, err := DecodeV1Item(enc); err == nil {
+		t.Errorf("expected error for short AREC item")
+	}
+}
@@ -5,6 +5,7 @@ package oldv1
 import (
 	. "github.com/ipref/ref"
 	"encoding/binary"
+	"errors"
 )
 
 const ( // v1 constants
@@ -17,6 +18,23 @@ const ( // v1 constants
 
 var be = binary.BigEndian
 
+var ErrInvalidIPVer = errors.New("invalid IPVER byte")
+
+// Returns the ea and gw IP lengths encoded in the header's V1_IPVER byte.
+func IPVerLens(ipver byte) (ea_iplen, gw_iplen int, err error) {
+	ea_iplen = IPVerToLen(int(ipver >> 4))
+	gw_iplen = IPVerToLen(int(ipver & 0x0f))
+	if ea_iplen == 0 || gw_iplen == 0 {
+		return 0, 0, ErrInvalidIPVer
+	}
+	return
+}
+
+// Returns the V1_IPVER header byte for the ea and gw IP lengths.
+func IPVerByte(ea_iplen, gw_iplen int) byte {
+	return byte(IPLenToVer(ea_iplen) << 4 | IPLenToVer(gw_iplen))
+}
+
 func AddrRecEncodedLen(ea_iplen, gw_iplen int) int {
 	return ea_iplen * 2 + gw_iplen + 16 // ea + ip + gw + ref.h + ref.l
 }
@@ -35,6 +53,21 @@ func AddrRecSlices(ea_iplen, gw_iplen int, arec []byte) (ea, ip, gw, refh, refl
 	return
 }
 
+// Checks that arec starts with a complete addrrec of the format given by the
+// header's V1_IPVER byte. Mirrors newv1.AddrRecCheck.
+func AddrRecCheck(ipver byte, arec []byte) (ok bool, length, ea_iplen, gw_iplen int) {
+	ea_iplen, gw_iplen, err := IPVerLens(ipver)
+	if err != nil {
+		return
+	}
+	length = AddrRecEncodedLen(ea_iplen, gw_iplen)
+	if len(arec) < length {
+		return
+	}
+	ok = true
+	return
+}
+
 func AddrRecEncode(arecb []byte, arec AddrRec) {
 	if arec.EA.Len() != arec.IP.Len() {
 		panic("unexpected")
@@ -47,6 +80,18 @@ func AddrRecEncode(arecb []byte, arec AddrRec) {
 	be.PutUint64(reflb, arec.Ref.L)
 }
 
+func AddrRecEncodeErr(arecb []byte, arec AddrRec) error {
+	length, err := AddrRecEncodedLenOfErr(arec)
+	if err != nil {
+		return err
+	}
+	if len(arecb) < length {
+		return ErrShortBuffer
+	}
+	AddrRecEncode(arecb, arec)
+	return nil
+}
+
 func AddrRecEncodedLenOf(arec AddrRec) int {
 	if arec.EA.Len() != arec.IP.Len() {
 		panic("unexpected")
@@ -54,6 +99,13 @@ func AddrRecEncodedLenOf(arec AddrRec) int {
 	return AddrRecEncodedLen(arec.EA.Len(), arec.GW.Len())
 }
 
+func AddrRecEncodedLenOfErr(arec AddrRec) (int, error) {
+	if err := arec.CheckEncodable(); err != nil {
+		return 0, err
+	}
+	return AddrRecEncodedLenOf(arec), nil
+}
+
 func AddrRecDecode(ea_iplen, gw_iplen int, arecb []byte) (arec AddrRec) {
 	eab, ipb, gwb, refhb, reflb := AddrRecSlices(ea_iplen, gw_iplen, arecb)
 	arec.EA = IPFromSlice(eab)
@@ -63,3 +115,54 @@ func AddrRecDecode(ea_iplen, gw_iplen int, arecb []byte) (arec AddrRec) {
 	arec.Ref.L = be.Uint64(reflb)
 	return
 }
+
+// Decodes the addrrec at the start of arecb, in the format given by the header's
+// V1_IPVER byte. Returns the number of bytes consumed. Safe on untrusted input.
+func AddrRecDecodeErr(ipver byte, arecb []byte) (int, AddrRec, error) {
+	ea_iplen, gw_iplen, err := IPVerLens(ipver)
+	if err != nil {
+		return 0, AddrRec{}, err
+	}
+	length := AddrRecEncodedLen(ea_iplen, gw_iplen)
+	if len(arecb) < length {
+		return 0, AddrRec{}, ErrShortBuffer
+	}
+	return length, AddrRecDecode(ea_iplen, gw_iplen, arecb), nil
+}
+
+// Implements AddrRecCodec for the oldv1 format
+type Codec struct{}
+
+func (Codec) Name() string {
+	return "oldv1"
+}
+
+func (Codec) EncodedLen(arec AddrRec) (int, error) {
+	return AddrRecEncodedLenOfErr(arec)
+}
+
+func (Codec) Encode(dst []byte, arec AddrRec) (int, error) {
+	if err := AddrRecEncodeErr(dst, arec); err != nil {
+		return 0, err
+	}
+	return AddrRecEncodedLenOf(arec), nil
+}
+
+func (Codec) Decode(hdr, src []byte) (int, AddrRec, error) {
+	if len(hdr) < V1_HDR_LEN {
+		return 0, AddrRec{}, ErrV1Malformed
+	}
+	return AddrRecDecodeErr(hdr[V1_IPVER], src)
+}
+
+func (Codec) SetHeader(hdr []byte, arec AddrRec) error {
+	if len(hdr) < V1_HDR_LEN {
+		return ErrShortBuffer
+	}
+	if err := arec.CheckEncodable(); err != nil {
+		return err
+	}
+	hdr[V1_IPVER] = IPVerByte(arec.EA.Len(), arec.GW.Len())
+	hdr[V1_RESERVED] = 0
+	return nil
+}
@@ -0,0 +1,38 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package oldv1
+
+import (
+	. "github.com/ipref/ref"
+	"testing"
+)
+
+func TestAddrRecDecodeErr(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=2001:db8::1 ref=1-2")
+	ipver := IPVerByte(4, 16)
+	if ipver != 0x46 {
+		t.Errorf("unexpected ipver byte %#x", ipver)
+	}
+	arecb := make([]byte, AddrRecEncodedLenOf(arec) + 3)
+	AddrRecEncode(arecb, arec)
+
+	length, x, err := AddrRecDecodeErr(ipver, arecb)
+	if err != nil || length != len(arecb) - 3 || x != arec {
+		t.Errorf("decoded %v %v %v", length, x, err)
+	}
+	if ok, l, ea_iplen, gw_iplen := AddrRecCheck(ipver, arecb); !ok || l != length ||
+		ea_iplen != 4 || gw_iplen != 16 {
+		t.Errorf("unexpected check result %v %v %v %v", ok, l, ea_iplen, gw_iplen)
+	}
+	for i := 0; i < length; i++ {
+		if _, _, err := AddrRecDecodeErr(ipver, arecb[:i]); err != ErrShortBuffer {
+			t.Errorf("truncated to %v: expected ErrShortBuffer, got %v", i, err)
+		}
+	}
+	for _, ipver := range []byte{0x00, 0x40, 0x45, 0x66 + 1} {
+		if _, _, err := AddrRecDecodeErr(ipver, arecb); err != ErrInvalidIPVer {
+			t.Errorf("ipver %#x: expected ErrInvalidIPVer, got %v", ipver, err)
+		}
+	}
+}
@@ -43,6 +43,14 @@ func RefPrefixFrom(ref Ref, bits int) RefPrefix {
 	return RefPrefix{Ref(val), bits}
 }
 
+func RefPrefixFromChecked(ref Ref, bits int) (RefPrefix, error) {
+
+	if bits < 0 || bits > 128 {
+		return RefPrefix{}, ErrInvalidPrefixLen
+	}
+	return RefPrefixFrom(ref, bits), nil
+}
+
 func (p RefPrefix) String() string {
 	return p.ref.StringInPrefix() + "/" + strconv.Itoa(p.bits)
 }
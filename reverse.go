@@ -0,0 +1,216 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Reverse DNS names. IP addresses use the standard in-addr.arpa and ip6.arpa
+ * trees. Refs use the ip6.arpa scheme, 32 nibbles in reverse order, under a
+ * zone chosen by the caller. All names are fully qualified, with a trailing dot.
+ */
+
+const (
+	REVERSE_ZONE_IPV4 = "in-addr.arpa."
+	REVERSE_ZONE_IPV6 = "ip6.arpa."
+)
+
+const hex_digits = "0123456789abcdef"
+
+// Returns the PTR name of the address, eg. 1.2.0.192.in-addr.arpa., or "" if
+// the address is uninitialized.
+func (ip IP) ReverseName() string {
+
+	if ip.IsZero() {
+		return ""
+	}
+	if ip.Is4() {
+		return ipv4_reverse_name(ip.AsSlice(), 4)
+	}
+	return nibble_reverse_name(ip.AsUint128(), 32, REVERSE_ZONE_IPV6)
+}
+
+// Returns the name of the first n octets of the address, in reverse order.
+func ipv4_reverse_name(octets []byte, n int) string {
+
+	var sb strings.Builder
+	for i := n - 1; i >= 0; i-- {
+		sb.WriteString(strconv.Itoa(int(octets[i])))
+		sb.WriteByte('.')
+	}
+	sb.WriteString(REVERSE_ZONE_IPV4)
+	return sb.String()
+}
+
+// Returns the name of the first n nibbles of val, in reverse order. An empty
+// zone is the root.
+func nibble_reverse_name(val Uint128, n int, zone string) string {
+
+	var sb strings.Builder
+	sb.Grow(n * 2 + len(zone))
+	for i := n - 1; i >= 0; i-- {
+		sb.WriteByte(hex_digits[val.Rsh(uint(124 - 4 * i)).L & 0xf])
+		sb.WriteByte('.')
+	}
+	sb.WriteString(zone)
+	if sb.Len() == 0 {
+		return "."
+	}
+	return sb.String()
+}
+
+// Returns the labels of the name preceding the zone, in reverse order. An
+// empty zone is the root.
+func reverse_labels(name, zone string) ([]string, bool) {
+
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	zone = strings.ToLower(strings.TrimSuffix(zone, "."))
+	if zone != "" {
+		if !strings.HasSuffix(name, "." + zone) {
+			return nil, false
+		}
+		name = strings.TrimSuffix(name, "." + zone)
+	}
+	if name == "" {
+		return nil, false
+	}
+	labels := strings.Split(name, ".")
+	for i, j := 0, len(labels) - 1; i < j; i, j = i + 1, j - 1 {
+		labels[i], labels[j] = labels[j], labels[i]
+	}
+	return labels, true
+}
+
+func parse_nibbles(labels []string) (Uint128, error) {
+
+	if len(labels) != 32 {
+		return Uint128{}, errors.New("reverse name must have 32 nibbles")
+	}
+	var val Uint128
+	for _, label := range labels {
+		if len(label) != 1 {
+			return Uint128{}, errors.New("invalid nibble in reverse name")
+		}
+		d := strings.IndexByte(hex_digits, label[0])
+		if d < 0 {
+			return Uint128{}, errors.New("invalid nibble in reverse name")
+		}
+		val = val.Lsh(4).Or(Uint128FromUint64(uint64(d)))
+	}
+	return val, nil
+}
+
+// Parses a full-length in-addr.arpa or ip6.arpa name. Case and the trailing dot
+// are ignored.
+func ParseReverseName(name string) (IP, error) {
+
+	if labels, ok := reverse_labels(name, REVERSE_ZONE_IPV4); ok {
+		if len(labels) != 4 {
+			return IP{}, errors.New("reverse name must have 4 octets")
+		}
+		var octets [4]byte
+		for i, label := range labels {
+			val, err := strconv.ParseUint(label, 10, 8)
+			if err != nil || len(label) > 1 && label[0] == '0' {
+				return IP{}, errors.New("invalid octet in reverse name")
+			}
+			octets[i] = byte(val)
+		}
+		return IPFromSlice(octets[:]), nil
+	}
+	if labels, ok := reverse_labels(name, REVERSE_ZONE_IPV6); ok {
+		val, err := parse_nibbles(labels)
+		if err != nil {
+			return IP{}, err
+		}
+		return IPFromUint128(val), nil
+	}
+	return IP{}, errors.New("not an in-addr.arpa or ip6.arpa name")
+}
+
+// Returns the minimal list of reverse zones which together cover the prefix,
+// or nil if the prefix is uninitialized. IPv4 prefixes longer than /24 use
+// RFC 2317 classless names, eg. 128/25.2.0.192.in-addr.arpa.
+func (p IPPrefix) ReverseZones() []string {
+
+	ip := p.Addr()
+	if ip.IsZero() {
+		return nil
+	}
+	bits := p.Bits()
+	if ip.Is6() {
+		return nibble_reverse_zones(ip.AsUint128(), bits, REVERSE_ZONE_IPV6)
+	}
+	octets := ip.AsSlice()
+	switch {
+	case bits == 32:
+		return []string{ipv4_reverse_name(octets, 4)}
+	case bits > 24:
+		return []string{strconv.Itoa(int(octets[3])) + "/" + strconv.Itoa(bits) +
+			"." + ipv4_reverse_name(octets, 3)}
+	case bits % 8 == 0:
+		return []string{ipv4_reverse_name(octets, bits / 8)}
+	}
+	n := bits / 8
+	count := 1 << (8 - bits % 8)
+	zones := make([]string, 0, count)
+	first := octets[n]
+	for i := 0; i < count; i++ {
+		octets[n] = first | byte(i)
+		zones = append(zones, ipv4_reverse_name(octets, n + 1))
+	}
+	return zones
+}
+
+func nibble_reverse_zones(val Uint128, bits int, zone string) []string {
+
+	n := bits / 4
+	if bits % 4 == 0 {
+		return []string{nibble_reverse_name(val, n, zone)}
+	}
+	count := 1 << (4 - bits % 4)
+	val = val.AndNot(Uint128FromUint64(uint64(count - 1)).Lsh(uint(124 - 4 * n)))
+	zones := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		x := val.Or(Uint128FromUint64(uint64(i)).Lsh(uint(124 - 4 * n)))
+		zones = append(zones, nibble_reverse_name(x, n + 1, zone))
+	}
+	return zones
+}
+
+// Returns the reverse name of the ref under the given zone, eg.
+// 2.1.0.0. ... .0.<zone>, or under the root if the zone is empty.
+func (ref Ref) ReverseName(zone string) string {
+	return nibble_reverse_name(Uint128(ref), 32, fqdn(zone))
+}
+
+// Parses a full-length reverse name of a ref under the given zone.
+func ParseRefReverseName(name, zone string) (Ref, error) {
+
+	labels, ok := reverse_labels(name, zone)
+	if !ok {
+		return Ref{}, errors.New("reverse name is not in zone " + fqdn(zone))
+	}
+	val, err := parse_nibbles(labels)
+	return Ref(val), err
+}
+
+// Returns the minimal list of reverse zones, under the given zone, which
+// together cover the ref prefix.
+func (p RefPrefix) ReverseZones(zone string) []string {
+	return nibble_reverse_zones(Uint128(p.ref), p.bits, fqdn(zone))
+}
+
+// Returns the name with a trailing dot. The empty name, the root, stays empty
+// for appending to labels.
+func fqdn(name string) string {
+
+	if name == "" || strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
@@ -0,0 +1,81 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReverseNames(t *testing.T) {
+
+	for _, c := range []struct {
+		ip   string
+		name string
+	}{
+		{"192.0.2.1", "1.2.0.192.in-addr.arpa."},
+		{"2001:db8::567:89ab", "b.a.9.8.7.6.5.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2.ip6.arpa."},
+	} {
+		ip := MustParseIP(c.ip)
+		if name := ip.ReverseName(); name != c.name {
+			t.Errorf("%v: expected %v, got %v", c.ip, c.name, name)
+		}
+		if x, err := ParseReverseName(strings.ToUpper(c.name)); err != nil || x != ip {
+			t.Errorf("%v: parsing %v: got %v %v", c.ip, c.name, x, err)
+		}
+	}
+	for _, name := range []string{"2.0.192.in-addr.arpa.", "01.2.0.192.in-addr.arpa",
+		"1.2.0.192.ip6.arpa", "1.2.0.192.example.com"} {
+		if _, err := ParseReverseName(name); err == nil {
+			t.Errorf("expected error parsing %v", name)
+		}
+	}
+
+	for _, c := range []struct {
+		prefix string
+		zones  []string
+	}{
+		{"10.0.0.0/8", []string{"10.in-addr.arpa."}},
+		{"10.4.0.0/14", []string{"4.10.in-addr.arpa.", "5.10.in-addr.arpa.",
+			"6.10.in-addr.arpa.", "7.10.in-addr.arpa."}},
+		{"192.0.2.128/25", []string{"128/25.2.0.192.in-addr.arpa."}},
+		{"2001:db8::/30", []string{"8.b.d.0.1.0.0.2.ip6.arpa.", "9.b.d.0.1.0.0.2.ip6.arpa.",
+			"a.b.d.0.1.0.0.2.ip6.arpa.", "b.b.d.0.1.0.0.2.ip6.arpa."}},
+	} {
+		zones := MustParseIPPrefix(c.prefix).ReverseZones()
+		if strings.Join(zones, " ") != strings.Join(c.zones, " ") {
+			t.Errorf("%v: expected %v, got %v", c.prefix, c.zones, zones)
+		}
+	}
+
+	ref := MustParseRef("12-abcd")
+	name := ref.ReverseName("ref.example")
+	if name != "d.c.b.a.2.1.0.0" + strings.Repeat(".0", 24) + ".ref.example." {
+		t.Errorf("unexpected ref reverse name %v", name)
+	}
+	if x, err := ParseRefReverseName(name, "ref.example."); err != nil || x != ref {
+		t.Errorf("parsing %v: got %v %v", name, x, err)
+	}
+	zones := MustParseRefPrefix("12--/14").ReverseZones("ref.example")
+	if len(zones) != 4 || zones[3] != "3.1.0.0.ref.example." {
+		t.Errorf("unexpected ref prefix zones %v", zones)
+	}
+
+	// zero values and the root zone
+	if name := (IP{}).ReverseName(); name != "" {
+		t.Errorf("zero IP reverse name %q", name)
+	}
+	if zones := (IPPrefix{}).ReverseZones(); zones != nil {
+		t.Errorf("zero prefix reverse zones %v", zones)
+	}
+	name = ref.ReverseName("")
+	if name != "d.c.b.a.2.1.0.0" + strings.Repeat(".0", 24) + "." {
+		t.Errorf("unexpected ref reverse name in the root %q", name)
+	}
+	if x, err := ParseRefReverseName(name, ""); err != nil || x != ref {
+		t.Errorf("parsing %v in the root: got %v %v", name, x, err)
+	}
+	if zones := MustParseRefPrefix("12--/14").ReverseZones(""); len(zones) != 4 || zones[0] != "0.1.0.0." {
+		t.Errorf("unexpected ref prefix zones in the root %v", zones)
+	}
+}
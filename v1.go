@@ -38,9 +38,9 @@ const ( // v1 constants
 
 const ( // v1 item types
 
-	//V1_TYPE_NONE   = 0
-	//V1_TYPE_AREC   = 1
-	//V1_TYPE_IPV4   = 3
+	V1_TYPE_NONE   = 0
+	V1_TYPE_AREC   = 1
+	V1_TYPE_IPV4   = 3
 	V1_TYPE_STRING = 4
 )
 
@@ -0,0 +1,259 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+/*
+ * Client sends V1 requests over one connection and matches the replies by
+ * packet ID. Any number of requests may be in flight. On datagram connections
+ * (udp, unixgram), requests are retransmitted until a reply arrives or the
+ * context is done. A NACK reply is returned as *NackError.
+ */
+
+const DEFAULT_RETRANSMIT = time.Second
+
+var (
+	ErrClientClosed    = errors.New("V1 client closed")
+	ErrTooManyInFlight = errors.New("too many V1 requests in flight")
+	ErrNoResult        = errors.New("V1 reply carries no result")
+)
+
+type NackError struct {
+	Cmd    byte
+	Reason string // may be empty
+}
+
+func (e *NackError) Error() string {
+
+	s := "V1 " + V1CmdName(e.Cmd) + " request NACKed"
+	if e.Reason != "" {
+		s += ": " + e.Reason
+	}
+	return s
+}
+
+type Client struct {
+	Codec      AddrRecCodec  // nil means newv1; read at the first request, later changes are ignored
+	Retransmit time.Duration // interval, on datagram connections only
+
+	conn     net.Conn
+	datagram bool
+	w        *Writer
+	mu       sync.Mutex
+	codec    AddrRecCodec // Codec, as of the first request
+	next     uint16
+	pending  map[uint16]chan reply
+	done     chan struct{}
+	err      error // why done was closed
+}
+
+type reply struct {
+	m   Message
+	err error
+}
+
+func NewClient(conn net.Conn) *Client {
+
+	c := &Client{
+		Retransmit: DEFAULT_RETRANSMIT,
+		conn:       conn,
+		w:          NewWriter(conn),
+		next:       uint16(rand.Uint32()),
+		pending:    make(map[uint16]chan reply),
+		done:       make(chan struct{}),
+	}
+	switch conn.LocalAddr().Network() {
+	case "udp", "udp4", "udp6", "unixgram":
+		c.datagram = true
+	}
+	go c.read_loop()
+	return c
+}
+
+// Closes the connection. Requests in flight fail with ErrClientClosed.
+func (c *Client) Close() error {
+
+	err := c.conn.Close()
+	c.shutdown(ErrClientClosed)
+	return err
+}
+
+// Sends the request and returns the ACK. The request's packet ID is assigned
+// here. A NACK is returned as *NackError.
+func (c *Client) Do(ctx context.Context, req Message) (Message, error) {
+
+	ch := make(chan reply, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	if len(c.pending) >= 0x10000 {
+		c.mu.Unlock()
+		return nil, ErrTooManyInFlight
+	}
+	if c.codec == nil {
+		c.codec = c.Codec
+		if c.codec == nil {
+			c.codec = newv1.Codec{}
+		}
+	}
+	codec := c.codec
+	for {
+		c.next++
+		if _, ok := c.pending[c.next]; !ok {
+			break
+		}
+	}
+	id := c.next
+	c.pending[id] = ch
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	req.SetID(id)
+	pkt, err := req.MarshalV1(codec)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.w.WritePacket(pkt); err != nil {
+		return nil, err
+	}
+	var tick <-chan time.Time
+	if c.datagram && c.Retransmit > 0 {
+		ticker := time.NewTicker(c.Retransmit)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case r := <-ch:
+			if r.err != nil {
+				return nil, r.err
+			}
+			if nack, ok := r.m.(*Nack); ok {
+				return nil, &NackError{nack.Command, nack.Reason}
+			}
+			if r.m.Cmd() != req.Cmd() {
+				return nil, ErrUnexpectedMessage
+			}
+			return r.m, nil
+		case <-tick:
+			if err := c.w.WritePacket(pkt); err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.done:
+			return nil, c.err
+		}
+	}
+}
+
+func (c *Client) read_loop() {
+
+	var read func() ([]byte, error)
+	if c.datagram {
+		buf := make([]byte, DEFAULT_MAX_PKT_LEN)
+		read = func() ([]byte, error) {
+			n, err := c.conn.Read(buf)
+			return buf[:n], err
+		}
+	} else {
+		read = NewReader(c.conn).ReadPacket
+	}
+	for {
+		pkt, err := read()
+		if err != nil {
+			if c.datagram && errors.Is(err, syscall.ECONNREFUSED) {
+				// after an ICMP port unreachable, the requests are
+				// retransmitted; back off in case the peer stays down
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			c.shutdown(err)
+			return
+		}
+		var hdr V1Header
+		if err := hdr.UnmarshalPacket(pkt); err != nil {
+			continue // stray datagram, framing errors end the stream above
+		}
+		if hdr.Mode != V1_ACK && hdr.Mode != V1_NACK {
+			continue
+		}
+		c.mu.Lock()
+		ch, ok := c.pending[hdr.PktID]
+		codec := c.codec
+		c.mu.Unlock()
+		if !ok {
+			continue // late reply or duplicate after retransmit
+		}
+		m, err := DecodeV1With(codec, pkt)
+		select {
+		case ch <- reply{m, err}:
+		default:
+		}
+	}
+}
+
+func (c *Client) shutdown(err error) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+		close(c.done)
+	}
+}
+
+// Returns the encoding address of the IpRef.
+func (c *Client) GetEA(ctx context.Context, ipref IpRef) (IP, error) {
+
+	if ipref.IP.IsZero() {
+		return IP{}, ErrUninitialized
+	}
+	zero := IPZero(ipref.IP.Len())
+	req := &GetEAReq{AddrRecs: []AddrRec{{EA: zero, IP: ipref.IP, GW: zero, Ref: ipref.Ref}}}
+	m, err := c.Do(ctx, req)
+	if err != nil {
+		return IP{}, err
+	}
+	ack, ok := m.(*GetEAAck)
+	if !ok || len(ack.AddrRecs) == 0 || ack.AddrRecs[0].EA.IsZeroAddr() {
+		return IP{}, ErrNoResult
+	}
+	return ack.AddrRecs[0].EA, nil
+}
+
+// Returns the IpRef the encoding address stands for.
+func (c *Client) GetRef(ctx context.Context, ea IP) (IpRef, error) {
+
+	if ea.IsZero() {
+		return IpRef{}, ErrUninitialized
+	}
+	zero := IPZero(ea.Len())
+	req := &GetRefReq{AddrRecs: []AddrRec{{EA: ea, IP: zero, GW: zero}}}
+	m, err := c.Do(ctx, req)
+	if err != nil {
+		return IpRef{}, err
+	}
+	ack, ok := m.(*GetRefAck)
+	if !ok || len(ack.AddrRecs) == 0 || ack.AddrRecs[0].IP.IsZeroAddr() {
+		return IpRef{}, ErrNoResult
+	}
+	return ack.AddrRecs[0].IpRef(), nil
+}
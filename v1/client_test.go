@@ -0,0 +1,220 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Answers GET_EA and GET_REF from a fixed addrrec, in reverse order of arrival
+// for each pair of requests, and NACKs everything else.
+func test_responder(conn net.Conn, arec AddrRec) {
+
+	r := NewReader(conn)
+	w := NewWriter(conn)
+	var held Message
+	for {
+		m, err := r.ReadMessage()
+		if err != nil {
+			return
+		}
+		var ack Message
+		switch req := m.(type) {
+		case *GetEAReq:
+			x := req.AddrRecs[0]
+			if x.IpRef() != arec.IpRef() {
+				ack = &Nack{Head{req.PktID}, req.Cmd(), "unknown ipref"}
+				break
+			}
+			ack = &GetEAAck{Head{req.PktID}, []AddrRec{arec}}
+		case *GetRefReq:
+			ack = &GetRefAck{Head{req.PktID}, []AddrRec{arec}}
+		default:
+			ack = &Nack{Command: m.Cmd()}
+			ack.SetID(m.ID())
+		}
+		if held == nil {
+			held = ack
+			continue
+		}
+		w.WriteMessage(ack)
+		w.WriteMessage(held)
+		held = nil
+	}
+}
+
+func TestClient(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2")
+	a, b := net.Pipe()
+	go test_responder(b, arec)
+	c := NewClient(a)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if ea, err := c.GetEA(ctx, arec.IpRef()); err != nil || ea != arec.EA {
+				t.Errorf("GetEA: expected %v, got %v %v", arec.EA, ea, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if ipref, err := c.GetRef(ctx, arec.EA); err != nil || ipref != arec.IpRef() {
+				t.Errorf("GetRef: expected %v, got %v %v", arec.IpRef(), ipref, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		_, err := c.GetEA(ctx, IpRef{IP: MustParseIP("192.0.2.9"), Ref: Ref{L: 1}})
+		var nack *NackError
+		if !errors.As(err, &nack) || nack.Cmd != V1_GET_EA || nack.Reason != "unknown ipref" {
+			t.Errorf("expected NackError, got %v", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if _, err := c.Do(ctx, &SetMarkReq{OID: 1, Mark: 2}); err == nil {
+			t.Errorf("expected NACK for SET_MARK")
+		}
+	}()
+	wg.Wait()
+
+	// the responder holds a lone request until another one arrives
+	short, cancel2 := context.WithTimeout(ctx, 50 * time.Millisecond)
+	defer cancel2()
+	if _, err := c.Do(short, &NoopReq{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+	c.Close()
+	if _, err := c.Do(ctx, &NoopReq{}); !errors.Is(err, ErrClientClosed) {
+		t.Errorf("expected ErrClientClosed, got %v", err)
+	}
+}
+
+func TestClientRetransmit(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2")
+	srv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer srv.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for i := 0; ; i++ {
+			n, from, err := srv.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if i == 0 {
+				continue // drop the first request
+			}
+			m, err := DecodeV1(buf[:n])
+			if err != nil {
+				continue
+			}
+			pkt, _ := (&GetEAAck{Head{m.ID()}, []AddrRec{arec}}).MarshalV1(newv1.Codec{})
+			srv.WriteTo(pkt, from)
+		}
+	}()
+	conn, err := net.Dial("udp", srv.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := NewClient(conn)
+	defer c.Close()
+	c.Retransmit = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	if ea, err := c.GetEA(ctx, arec.IpRef()); err != nil || ea != arec.EA {
+		t.Errorf("expected %v, got %v %v", arec.EA, ea, err)
+	}
+}
+
+// A connected UDP socket reports ICMP port unreachable as a read error, which
+// must not end the client.
+func TestClientRefused(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2")
+	srv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	addr := srv.LocalAddr().String()
+	srv.Close() // nobody listens until later
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := NewClient(conn)
+	defer c.Close()
+	c.Retransmit = 20 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	result := make(chan error, 1)
+	go func() {
+		_, err := c.GetEA(ctx, arec.IpRef())
+		result <- err
+	}()
+	time.Sleep(100 * time.Millisecond) // several refused retransmissions
+	srv, err = net.ListenPacket("udp", addr)
+	if err != nil {
+		t.Skipf("cannot listen again on %v: %v", addr, err)
+	}
+	defer srv.Close()
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, from, err := srv.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if m, err := DecodeV1(buf[:n]); err == nil {
+				pkt, _ := (&GetEAAck{Head{m.ID()}, []AddrRec{arec}}).MarshalV1(newv1.Codec{})
+				srv.WriteTo(pkt, from)
+			}
+		}
+	}()
+	if err := <-result; err != nil {
+		t.Errorf("unexpected error after refused requests: %v", err)
+	}
+}
+
+func TestClientReadError(t *testing.T) {
+
+	srv, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on udp: %v", err)
+	}
+	defer srv.Close()
+	conn, err := net.Dial("udp", srv.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	conn.SetReadDeadline(time.Now()) // not transient, ends the client
+	c := NewClient(conn)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2")
+	if _, err := c.GetEA(ctx, arec.IpRef()); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+/*
+ * Host data is sent in batches. A batch is a set of addrrecs from one source,
+ * split across V1_MC_HOST_DATA packets, followed by a V1_MC_HOST_DATA_HASH
+ * request to confirm. For MC_HOST_DATA, the packet ID is the sequence number of
+ * the packet within its batch. Every packet carries the batch ID, the source,
+ * and the hash of the whole batch. The hash request carries the number of
+ * packets, the hash and the source, which identify the batch.
+ *
+ * The hash is FNV-1a 64 over the sorted addrrecs in the newv1 format, so it
+ * doesn't depend on the order of the records nor on the protocol version.
+ */
+
+const HOST_DATA_MAX_PKTS = 0x10000 // packet sequence numbers are uint16
+
+var (
+	ErrMTUTooSmall          = errors.New("MTU too small for host data packet")
+	ErrHostDataTooLarge     = errors.New("host data batch needs more than 65536 packets")
+	ErrHostDataUnknownBatch = errors.New("no host data received for batch")
+	ErrHostDataInconsistent = errors.New("host data packets of batch disagree")
+	ErrHostDataHash         = errors.New("host data batch hash mismatch")
+)
+
+// Some packets of a batch haven't arrived.
+type HostDataMissingError struct {
+	BatchID uint32
+	Missing []uint16 // sequence numbers
+}
+
+func (e *HostDataMissingError) Error() string {
+	return fmt.Sprintf("host data batch %v is missing %v of its packets", e.BatchID, len(e.Missing))
+}
+
+// Returns the batch hash of the addrrecs, or ErrUninitialized if any of their
+// addresses is uninitialized.
+func HostDataHash(arecs []AddrRec) (uint64, error) {
+
+	for _, arec := range arecs {
+		if arec.EA.IsZero() || arec.IP.IsZero() || arec.GW.IsZero() {
+			return 0, ErrUninitialized
+		}
+	}
+	sorted := append([]AddrRec(nil), arecs...)
+	sort_host_data(sorted)
+	h := fnv.New64a()
+	for _, arec := range sorted {
+		arecb, err := newv1.AddrRecAsSliceErr(arec)
+		if err != nil {
+			return 0, err
+		}
+		h.Write(arecb)
+	}
+	return h.Sum64(), nil
+}
+
+// Orders by EA and GW versions, so that oldv1 packets can be filled with
+// addrrecs of the same format, then by AddrRec.Compare.
+func sort_host_data(arecs []AddrRec) {
+
+	sort.Slice(arecs, func(i, j int) bool {
+		a, b := arecs[i], arecs[j]
+		if a.EA.Len() != b.EA.Len() {
+			return a.EA.Len() < b.EA.Len()
+		}
+		if a.GW.Len() != b.GW.Len() {
+			return a.GW.Len() < b.GW.Len()
+		}
+		return a.Compare(b) < 0
+	})
+}
+
+// Splits the addrrecs into MC_HOST_DATA packets, each no longer than mtu when
+// encoded with the codec. Returns the packets, in sequence, and the hash
+// request which completes the batch.
+func BuildHostData(batchid uint32, source string, arecs []AddrRec, mtu int, codec AddrRecCodec) ([]*HostData, *HostDataHashReq, error) {
+
+	hash, err := HostDataHash(arecs)
+	if err != nil {
+		return nil, nil, err
+	}
+	sorted := append([]AddrRec(nil), arecs...)
+	sort_host_data(sorted)
+	overhead := V1_HDR_LEN + V1_HOST_DATA_SOURCE + V1ItemLen(len(source))
+	var pkts []*HostData
+	var cur *HostData
+	var curlen int
+	var curformat [V1_HDR_LEN]byte
+	for _, arec := range sorted {
+		n, err := codec.EncodedLen(arec)
+		if err != nil {
+			return nil, nil, err
+		}
+		if overhead + n > mtu {
+			return nil, nil, ErrMTUTooSmall
+		}
+		var format [V1_HDR_LEN]byte
+		if err := codec.SetHeader(format[:], arec); err != nil {
+			return nil, nil, err
+		}
+		if cur == nil || curlen + n > mtu || format != curformat {
+			if len(pkts) == HOST_DATA_MAX_PKTS {
+				return nil, nil, ErrHostDataTooLarge
+			}
+			cur = &HostData{Head{uint16(len(pkts))}, batchid, hash, source, nil}
+			pkts = append(pkts, cur)
+			curlen = overhead
+			curformat = format
+		}
+		cur.AddrRecs = append(cur.AddrRecs, arec)
+		curlen += n
+	}
+	if len(pkts) == 0 {
+		// an empty batch still needs a packet to carry its batch ID
+		pkts = append(pkts, &HostData{Head{0}, batchid, hash, source, nil})
+	}
+	return pkts, &HostDataHashReq{Count: uint32(len(pkts)), Hash: hash, Source: source}, nil
+}
+
+// Collects MC_HOST_DATA packets until their batch is confirmed with a hash
+// request. Batches are tracked by source and batch ID, so a resend of the same
+// content under a new batch ID starts a new batch. Safe for concurrent use.
+type HostDataAssembler struct {
+	mu      sync.Mutex
+	batches map[hd_key]*hd_batch
+}
+
+type hd_key struct {
+	source  string
+	batchid uint32
+}
+
+type hd_batch struct {
+	hash  uint64
+	pkts  map[uint16][]AddrRec
+	first time.Time
+}
+
+// A complete batch
+type HostDataBatch struct {
+	BatchID  uint32
+	Source   string
+	Hash     uint64
+	AddrRecs []AddrRec // in the order sent
+}
+
+func NewHostDataAssembler() *HostDataAssembler {
+	return &HostDataAssembler{batches: make(map[hd_key]*hd_batch)}
+}
+
+func (a *HostDataAssembler) Add(m *HostData) error {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	key := hd_key{m.Source, m.BatchID}
+	b, ok := a.batches[key]
+	if !ok {
+		b = &hd_batch{hash: m.Hash, pkts: make(map[uint16][]AddrRec), first: time.Now()}
+		a.batches[key] = b
+	}
+	if b.hash != m.Hash {
+		return ErrHostDataInconsistent
+	}
+	b.pkts[m.PktID] = m.AddrRecs // duplicates replace the earlier copy
+	return nil
+}
+
+// Returns the batches of the source with the hash, latest first.
+func (a *HostDataAssembler) find(source string, hash uint64) []hd_key {
+
+	var keys []hd_key
+	for key, b := range a.batches {
+		if key.source == source && b.hash == hash {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return a.batches[keys[i]].first.After(a.batches[keys[j]].first)
+	})
+	return keys
+}
+
+// Returns the sequence numbers of the packets not yet received, out of count,
+// for the latest batch of the source with the hash. Count is capped at
+// HOST_DATA_MAX_PKTS.
+func (a *HostDataAssembler) Missing(source string, hash uint64, count int) []uint16 {
+
+	count = min(count, HOST_DATA_MAX_PKTS)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	var b *hd_batch
+	if keys := a.find(source, hash); len(keys) > 0 {
+		b = a.batches[keys[0]]
+	}
+	return b.missing(count)
+}
+
+func (b *hd_batch) missing(count int) []uint16 {
+
+	var missing []uint16
+	for seq := 0; seq < count; seq++ {
+		if b == nil {
+			missing = append(missing, uint16(seq))
+		} else if _, ok := b.pkts[uint16(seq)]; !ok {
+			missing = append(missing, uint16(seq))
+		}
+	}
+	return missing
+}
+
+// Completes the batch identified by the hash request. If several batches of
+// the source have the hash, eg. after a resend under a new batch ID, the latest
+// with all its packets is used. If every such batch is missing packets, returns
+// *HostDataMissingError for the latest one and keeps the batches, so the
+// missing packets may still be added. Otherwise, the batches with the hash are
+// removed, and the complete one is returned if its hash matches. A count of
+// zero or above HOST_DATA_MAX_PKTS is reported as ErrHostDataInconsistent.
+func (a *HostDataAssembler) Complete(m *HostDataHashReq) (HostDataBatch, error) {
+
+	if m.Count == 0 || m.Count > HOST_DATA_MAX_PKTS {
+		return HostDataBatch{}, ErrHostDataInconsistent
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	keys := a.find(m.Source, m.Hash)
+	if len(keys) == 0 {
+		return HostDataBatch{}, ErrHostDataUnknownBatch
+	}
+	key := keys[0]
+	for _, k := range keys {
+		if len(a.batches[k].missing(int(m.Count))) == 0 {
+			key = k
+			break
+		}
+	}
+	b := a.batches[key]
+	if missing := b.missing(int(m.Count)); len(missing) > 0 {
+		return HostDataBatch{}, &HostDataMissingError{key.batchid, missing}
+	}
+	for _, k := range keys {
+		delete(a.batches, k)
+	}
+	if len(b.pkts) != int(m.Count) {
+		return HostDataBatch{}, ErrHostDataInconsistent // packets beyond count
+	}
+	batch := HostDataBatch{BatchID: key.batchid, Source: m.Source, Hash: m.Hash}
+	for seq := 0; seq < int(m.Count); seq++ {
+		batch.AddrRecs = append(batch.AddrRecs, b.pkts[uint16(seq)]...)
+	}
+	if hash, err := HostDataHash(batch.AddrRecs); err != nil || hash != m.Hash {
+		return HostDataBatch{}, ErrHostDataHash
+	}
+	return batch, nil
+}
+
+// Drops incomplete batches whose first packet arrived before the time. Returns
+// the number dropped.
+func (a *HostDataAssembler) Expire(before time.Time) int {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	n := 0
+	for key, b := range a.batches {
+		if b.first.Before(before) {
+			delete(a.batches, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (a *HostDataAssembler) Len() int {
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.batches)
+}
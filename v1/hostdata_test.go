@@ -0,0 +1,158 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"github.com/ipref/ref/oldv1"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func test_host_data(n int) []AddrRec {
+
+	var arecs []AddrRec
+	for i := 0; i < n; i++ {
+		s := fmt.Sprintf("ea=10.240.%v.%v ip=192.0.2.%v gw=8.8.4.4 ref=%v", i / 256, i % 256, i % 256, i + 1)
+		if i % 3 == 0 {
+			s = fmt.Sprintf("ea=fd00::%x ip=2001:db8::%x gw=8.8.8.8 ref=%v", i, i, i + 1)
+		}
+		arecs = append(arecs, MustParseAddrRec(s))
+	}
+	return arecs
+}
+
+func TestHostData(t *testing.T) {
+
+	arecs := test_host_data(300)
+	for _, codec := range []AddrRecCodec{oldv1.Codec{}, newv1.Codec{}} {
+		pkts, hreq, err := BuildHostData(7, "/etc/hosts", arecs, 512, codec)
+		if err != nil {
+			t.Fatalf("%v: unexpected error: %v", codec.Name(), err)
+		}
+		if int(hreq.Count) != len(pkts) || len(pkts) < 2 {
+			t.Fatalf("%v: unexpected packet count %v, %v", codec.Name(), hreq.Count, len(pkts))
+		}
+		shuffled := append([]AddrRec(nil), arecs...)
+		rand.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		if hash, _ := HostDataHash(shuffled); hash != hreq.Hash {
+			t.Errorf("%v: hash depends on record order", codec.Name())
+		}
+
+		a := NewHostDataAssembler()
+		for i, pkt := range pkts {
+			enc, err := pkt.MarshalV1(codec)
+			if err != nil || len(enc) > 512 {
+				t.Fatalf("%v: packet %v: %v bytes, %v", codec.Name(), i, len(enc), err)
+			}
+			m, err := DecodeV1With(codec, enc)
+			if err != nil {
+				t.Fatalf("%v: packet %v: %v", codec.Name(), i, err)
+			}
+			if i == 1 {
+				continue // lost
+			}
+			if err := a.Add(m.(*HostData)); err != nil {
+				t.Fatalf("%v: unexpected error: %v", codec.Name(), err)
+			}
+		}
+		_, err = a.Complete(hreq)
+		var merr *HostDataMissingError
+		if !errors.As(err, &merr) || !reflect.DeepEqual(merr.Missing, []uint16{1}) || merr.BatchID != 7 {
+			t.Fatalf("%v: expected packet 1 missing, got %v", codec.Name(), err)
+		}
+		a.Add(pkts[1])
+		batch, err := a.Complete(hreq)
+		if err != nil || len(batch.AddrRecs) != len(arecs) || batch.BatchID != 7 {
+			t.Fatalf("%v: unexpected result %v records, %v", codec.Name(), len(batch.AddrRecs), err)
+		}
+		if hash, _ := HostDataHash(batch.AddrRecs); hash != hreq.Hash {
+			t.Errorf("%v: reassembled batch has a different hash", codec.Name())
+		}
+		if a.Len() != 0 {
+			t.Errorf("%v: completed batch not removed", codec.Name())
+		}
+	}
+}
+
+func TestHostDataErrors(t *testing.T) {
+
+	arecs := test_host_data(10)
+	if _, _, err := BuildHostData(1, "src", arecs, 40, newv1.Codec{}); !errors.Is(err, ErrMTUTooSmall) {
+		t.Errorf("expected ErrMTUTooSmall, got %v", err)
+	}
+	pkts, hreq, _ := BuildHostData(1, "src", arecs, 1500, newv1.Codec{})
+	a := NewHostDataAssembler()
+	if _, err := a.Complete(hreq); !errors.Is(err, ErrHostDataUnknownBatch) {
+		t.Errorf("expected ErrHostDataUnknownBatch, got %v", err)
+	}
+	bad := *pkts[0]
+	bad.AddrRecs = bad.AddrRecs[1:]
+	a.Add(&bad)
+	if _, err := a.Complete(hreq); !errors.Is(err, ErrHostDataHash) {
+		t.Errorf("expected ErrHostDataHash, got %v", err)
+	}
+	huge := *hreq
+	huge.Count = 0xffffffff
+	if _, err := a.Complete(&huge); !errors.Is(err, ErrHostDataInconsistent) {
+		t.Errorf("expected ErrHostDataInconsistent for oversized count, got %v", err)
+	}
+	if missing := a.Missing("src", hreq.Hash, 0x7fffffff); len(missing) != HOST_DATA_MAX_PKTS {
+		t.Errorf("expected capped missing packets, got %v", len(missing))
+	}
+	a.Add(pkts[0])
+	other := *pkts[0]
+	other.Hash++
+	if err := a.Add(&other); !errors.Is(err, ErrHostDataInconsistent) {
+		t.Errorf("expected ErrHostDataInconsistent, got %v", err)
+	}
+	if n := a.Expire(time.Now().Add(time.Second)); n != 1 || a.Len() != 0 {
+		t.Errorf("expected 1 expired batch, got %v", n)
+	}
+	uninit := append(test_host_data(3), AddrRec{IP: arecs[0].IP, Ref: arecs[0].Ref})
+	if _, err := HostDataHash(uninit); !errors.Is(err, ErrUninitialized) {
+		t.Errorf("expected ErrUninitialized hashing, got %v", err)
+	}
+	if _, _, err := BuildHostData(1, "src", uninit, 1500, newv1.Codec{}); !errors.Is(err, ErrUninitialized) {
+		t.Errorf("expected ErrUninitialized building, got %v", err)
+	}
+	pkts, hreq, err := BuildHostData(3, "empty", nil, 1500, oldv1.Codec{})
+	if err != nil || len(pkts) != 1 || hreq.Count != 1 {
+		t.Errorf("unexpected empty batch %v %v %v", len(pkts), hreq, err)
+	}
+}
+
+func TestHostDataResend(t *testing.T) {
+
+	arecs := test_host_data(100)
+	pkts, hreq, err := BuildHostData(1, "src", arecs, 512, newv1.Codec{})
+	if err != nil || len(pkts) < 2 {
+		t.Fatalf("unexpected batch: %v packets, %v", len(pkts), err)
+	}
+	a := NewHostDataAssembler()
+	a.Add(pkts[0]) // the first attempt is lost after its first packet
+	if _, err := a.Complete(hreq); err == nil {
+		t.Fatalf("expected incomplete batch")
+	}
+	retry, hreq2, _ := BuildHostData(2, "src", arecs, 512, newv1.Codec{})
+	for _, pkt := range retry {
+		if err := a.Add(pkt); err != nil {
+			t.Fatalf("unexpected error adding resent packet: %v", err)
+		}
+	}
+	if missing := a.Missing("src", hreq2.Hash, int(hreq2.Count)); len(missing) != 0 {
+		t.Errorf("unexpected missing packets: %v", missing)
+	}
+	batch, err := a.Complete(hreq2)
+	if err != nil || batch.BatchID != 2 || len(batch.AddrRecs) != len(arecs) {
+		t.Fatalf("unexpected result: batch %v, %v records, %v", batch.BatchID, len(batch.AddrRecs), err)
+	}
+	if a.Len() != 0 {
+		t.Errorf("superseded batch not removed")
+	}
+}
@@ -0,0 +1,837 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"github.com/ipref/ref/oldv1"
+	"encoding/binary"
+	"errors"
+)
+
+/*
+ * Typed messages of the V1 protocol, one per command and mode. A message is
+ * encoded with MarshalV1 and decoded with UnmarshalV1, given the AddrRecCodec
+ * of the protocol version (oldv1.Codec{} or newv1.Codec{}). Commands which don't
+ * carry addrrecs encode the same in both versions.
+ *
+ * Payloads:
+ *
+ *	SET_AREC          oid, mark, addrrecs
+ *	SET_MARK          oid, mark
+ *	GET_REF, GET_EA   addrrecs
+ *	MC_GET_EA         addrrecs
+ *	RECOVER_EA        addrrecs
+ *	RECOVER_REF       addrrecs
+ *	SAVE_OID          oid, name (ACK: oid)
+ *	SAVE_TIME_BASE    oid, time base in unix seconds (ACK: oid)
+ *	MC_HOST_DATA      batch id, hash, source, addrrecs (DATA only)
+ *	MC_HOST_DATA_HASH count, hash, source
+ *	SAVE_DNSSOURCE    oid, mark (ACK: xmark), hash, source
+ *	NACK              optional reason
+ *
+ * Integers are big endian, 4 bytes, except hashes and time bases which are 8
+ * bytes. Strings are V1_TYPE_STRING items. Addrrecs always come last and run to
+ * the end of the packet.
+ */
+
+var be = binary.BigEndian
+
+var (
+	ErrUnexpectedMessage = errors.New("V1 packet is not of the expected command and mode")
+	ErrMixedAddrRecs     = errors.New("addrrecs in message don't share a format")
+)
+
+type Message interface {
+	Cmd() byte  // V1 command, without the mode bits
+	Mode() byte // V1_DATA, V1_REQ, V1_ACK or V1_NACK
+	ID() uint16
+	SetID(id uint16)
+	MarshalV1(codec AddrRecCodec) ([]byte, error)
+	UnmarshalV1(codec AddrRecCodec, pkt []byte) error
+	encode(e *encoder) error
+	decode(d *decoder)
+}
+
+// The packet ID, common to all messages
+type Head struct {
+	PktID uint16
+}
+
+func (h *Head) ID() uint16 {
+	return h.PktID
+}
+
+func (h *Head) SetID(id uint16) {
+	h.PktID = id
+}
+
+// Appends the encoded message to dst.
+func AppendV1(dst []byte, m Message, codec AddrRecCodec) ([]byte, error) {
+
+	start := len(dst)
+	hdr := V1Header{Cmd: m.Cmd(), Mode: m.Mode(), PktID: m.ID(), PktLen: V1_HDR_LEN}
+	dst = append(dst, make([]byte, V1_HDR_LEN)...)
+	if err := hdr.Marshal(dst[start:]); err != nil {
+		return dst[:start], err
+	}
+	e := encoder{codec, dst, start}
+	if err := m.encode(&e); err != nil {
+		return dst[:start], err
+	}
+	pktlen := len(e.b) - start
+	if pktlen % V1_PKTLEN_UNIT != 0 || pktlen > V1_MAX_PKT_LEN {
+		return dst[:start], ErrV1PktLen
+	}
+	be.PutUint16(e.b[start+V1_PKTLEN:], uint16(pktlen / V1_PKTLEN_UNIT))
+	return e.b, nil
+}
+
+func marshal(m Message, codec AddrRecCodec) ([]byte, error) {
+	return AppendV1(nil, m, codec)
+}
+
+func unmarshal(m Message, codec AddrRecCodec, pkt []byte) error {
+
+	var hdr V1Header
+	if err := hdr.UnmarshalPacket(pkt); err != nil {
+		return err
+	}
+	if hdr.Cmd != m.Cmd() || hdr.Mode != m.Mode() {
+		return ErrUnexpectedMessage
+	}
+	m.SetID(hdr.PktID)
+	d := decoder{codec: codec, hdr: pkt[:V1_HDR_LEN], b: pkt[V1_HDR_LEN:]}
+	m.decode(&d)
+	if d.err == nil && len(d.b) != 0 {
+		d.err = ErrV1Malformed // trailing bytes
+	}
+	return d.err
+}
+
+// Returns the codec of the packet's protocol version. Oldv1 packets carrying
+// addrrecs have a non-zero V1_IPVER, newv1 packets have zero V1_RESERVED. For
+// packets without addrrecs, both codecs decode the same.
+func DetectCodec(pkt []byte) AddrRecCodec {
+
+	if len(pkt) > oldv1.V1_IPVER && pkt[oldv1.V1_IPVER] != 0 {
+		return oldv1.Codec{}
+	}
+	return newv1.Codec{}
+}
+
+// Decodes a packet of either protocol version into its message type.
+func DecodeV1(pkt []byte) (Message, error) {
+	return DecodeV1With(DetectCodec(pkt), pkt)
+}
+
+func DecodeV1With(codec AddrRecCodec, pkt []byte) (Message, error) {
+
+	var hdr V1Header
+	if err := hdr.UnmarshalPacket(pkt); err != nil {
+		return nil, err
+	}
+	m := NewMessage(hdr.Cmd, hdr.Mode)
+	if m == nil {
+		return nil, ErrUnexpectedMessage
+	}
+	if err := m.UnmarshalV1(codec, pkt); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Returns a new zero message of the command and mode, or nil if there is no
+// such message.
+func NewMessage(cmd, mode byte) Message {
+
+	if mode == V1_NACK {
+		if !V1CmdKnown(cmd) {
+			return nil
+		}
+		return &Nack{Command: cmd}
+	}
+	if fn, ok := messages[cmd | mode]; ok {
+		return fn()
+	}
+	return nil
+}
+
+var messages = map[byte]func() Message{
+	V1_NOOP | V1_REQ:              func() Message { return &NoopReq{} },
+	V1_NOOP | V1_ACK:              func() Message { return &NoopAck{} },
+	V1_SET_AREC | V1_REQ:          func() Message { return &SetAddrRecReq{} },
+	V1_SET_AREC | V1_ACK:          func() Message { return &SetAddrRecAck{} },
+	V1_SET_MARK | V1_REQ:          func() Message { return &SetMarkReq{} },
+	V1_SET_MARK | V1_ACK:          func() Message { return &SetMarkAck{} },
+	V1_GET_REF | V1_REQ:           func() Message { return &GetRefReq{} },
+	V1_GET_REF | V1_ACK:           func() Message { return &GetRefAck{} },
+	V1_GET_EA | V1_REQ:            func() Message { return &GetEAReq{} },
+	V1_GET_EA | V1_ACK:            func() Message { return &GetEAAck{} },
+	V1_MC_GET_EA | V1_REQ:         func() Message { return &MCGetEAReq{} },
+	V1_MC_GET_EA | V1_ACK:         func() Message { return &MCGetEAAck{} },
+	V1_SAVE_OID | V1_REQ:          func() Message { return &SaveOIDReq{} },
+	V1_SAVE_OID | V1_ACK:          func() Message { return &SaveOIDAck{} },
+	V1_SAVE_TIME_BASE | V1_REQ:    func() Message { return &SaveTimeBaseReq{} },
+	V1_SAVE_TIME_BASE | V1_ACK:    func() Message { return &SaveTimeBaseAck{} },
+	V1_RECOVER_EA | V1_REQ:        func() Message { return &RecoverEAReq{} },
+	V1_RECOVER_EA | V1_ACK:        func() Message { return &RecoverEAAck{} },
+	V1_RECOVER_REF | V1_REQ:       func() Message { return &RecoverRefReq{} },
+	V1_RECOVER_REF | V1_ACK:       func() Message { return &RecoverRefAck{} },
+	V1_MC_HOST_DATA | V1_DATA:     func() Message { return &HostData{} },
+	V1_MC_HOST_DATA_HASH | V1_REQ: func() Message { return &HostDataHashReq{} },
+	V1_MC_HOST_DATA_HASH | V1_ACK: func() Message { return &HostDataHashAck{} },
+	V1_SAVE_DNSSOURCE | V1_REQ:    func() Message { return &SaveDNSSourceReq{} },
+	V1_SAVE_DNSSOURCE | V1_ACK:    func() Message { return &SaveDNSSourceAck{} },
+}
+
+// -------------------- encoder/decoder --------------------
+
+type encoder struct {
+	codec AddrRecCodec
+	b     []byte
+	start int // of the packet in b
+}
+
+func (e *encoder) u32(x uint32) {
+	e.b = be.AppendUint32(e.b, x)
+}
+
+func (e *encoder) u64(x uint64) {
+	e.b = be.AppendUint64(e.b, x)
+}
+
+func (e *encoder) str(s string) error {
+	return e.item(V1_TYPE_STRING, s)
+}
+
+func (e *encoder) item(typ byte, val any) error {
+
+	b, err := AppendV1Item(e.b, typ, val)
+	e.b = b
+	return err
+}
+
+func (e *encoder) dnssource(s DNSSource, ack bool) error {
+
+	b, err := s.AppendV1(e.b, ack)
+	e.b = b
+	return err
+}
+
+func (e *encoder) arecs(arecs []AddrRec) error {
+
+	hdr := e.b[e.start:e.start+V1_HDR_LEN]
+	for i, arec := range arecs {
+		if i == 0 {
+			if err := e.codec.SetHeader(hdr, arec); err != nil {
+				return err
+			}
+		} else {
+			var x [V1_HDR_LEN]byte
+			copy(x[:], hdr)
+			if err := e.codec.SetHeader(x[:], arec); err != nil {
+				return err
+			}
+			if string(x[:]) != string(hdr) {
+				return ErrMixedAddrRecs
+			}
+		}
+		n, err := e.codec.EncodedLen(arec)
+		if err != nil {
+			return err
+		}
+		at := len(e.b)
+		e.b = append(e.b, make([]byte, n)...)
+		hdr = e.b[e.start:e.start+V1_HDR_LEN] // e.b may have moved
+		if _, err := e.codec.Encode(e.b[at:], arec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Decodes payload fields in order. The first error sticks, later fields decode
+// as zero.
+type decoder struct {
+	codec AddrRecCodec
+	hdr   []byte
+	b     []byte // remaining payload
+	err   error
+}
+
+func (d *decoder) u32() uint32 {
+
+	if d.err != nil || len(d.b) < 4 {
+		d.fail(ErrV1Malformed)
+		return 0
+	}
+	x := be.Uint32(d.b)
+	d.b = d.b[4:]
+	return x
+}
+
+func (d *decoder) u64() uint64 {
+
+	if d.err != nil || len(d.b) < 8 {
+		d.fail(ErrV1Malformed)
+		return 0
+	}
+	x := be.Uint64(d.b)
+	d.b = d.b[8:]
+	return x
+}
+
+func (d *decoder) str() string {
+
+	s, _ := d.item(V1_TYPE_STRING).(string)
+	return s
+}
+
+// Decodes an item which must be of the given type.
+func (d *decoder) item(typ byte) any {
+
+	if d.err != nil {
+		return nil
+	}
+	t, val, n, err := DecodeV1Item(d.b)
+	if err != nil || t != typ {
+		d.fail(ErrV1Malformed)
+		return nil
+	}
+	d.b = d.b[n:]
+	return val
+}
+
+func (d *decoder) dnssource(ack bool) DNSSource {
+
+	if d.err != nil {
+		return DNSSource{}
+	}
+	s, n, err := DecodeDNSSource(d.b, ack)
+	if err != nil {
+		d.fail(ErrV1Malformed)
+		return DNSSource{}
+	}
+	d.b = d.b[n:]
+	return s
+}
+
+// Decodes addrrecs to the end of the payload.
+func (d *decoder) arecs() []AddrRec {
+
+	var arecs []AddrRec
+	for d.err == nil && len(d.b) > 0 {
+		n, arec, err := d.codec.Decode(d.hdr, d.b)
+		if err != nil {
+			d.fail(err)
+			return nil
+		}
+		arecs = append(arecs, arec)
+		d.b = d.b[n:]
+	}
+	return arecs
+}
+
+// Reports whether there is more payload.
+func (d *decoder) more() bool {
+	return d.err == nil && len(d.b) > 0
+}
+
+func (d *decoder) fail(err error) {
+	if d.err == nil {
+		d.err = err
+	}
+}
+
+// -------------------- messages --------------------
+
+type NoopReq struct {
+	Head
+}
+
+func (*NoopReq) Cmd() byte                                  { return V1_NOOP }
+func (*NoopReq) Mode() byte                                 { return V1_REQ }
+func (m *NoopReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *NoopReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *NoopReq) encode(e *encoder) error { return nil }
+func (m *NoopReq) decode(d *decoder)       {}
+
+type NoopAck struct {
+	Head
+}
+
+func (*NoopAck) Cmd() byte                                  { return V1_NOOP }
+func (*NoopAck) Mode() byte                                 { return V1_ACK }
+func (m *NoopAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *NoopAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *NoopAck) encode(e *encoder) error { return nil }
+func (m *NoopAck) decode(d *decoder)       {}
+
+type SetAddrRecReq struct {
+	Head
+	OID      OID
+	Mark     Mark
+	AddrRecs []AddrRec
+}
+
+func (*SetAddrRecReq) Cmd() byte                                  { return V1_SET_AREC }
+func (*SetAddrRecReq) Mode() byte                                 { return V1_REQ }
+func (m *SetAddrRecReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SetAddrRecReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SetAddrRecReq) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	e.u32(uint32(m.Mark))
+	return e.arecs(m.AddrRecs)
+}
+
+func (m *SetAddrRecReq) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.Mark = Mark(d.u32())
+	m.AddrRecs = d.arecs()
+}
+
+type SetAddrRecAck struct {
+	Head
+	OID  OID
+	Mark Mark
+}
+
+func (*SetAddrRecAck) Cmd() byte                                  { return V1_SET_AREC }
+func (*SetAddrRecAck) Mode() byte                                 { return V1_ACK }
+func (m *SetAddrRecAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SetAddrRecAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SetAddrRecAck) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	e.u32(uint32(m.Mark))
+	return nil
+}
+
+func (m *SetAddrRecAck) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.Mark = Mark(d.u32())
+}
+
+type SetMarkReq struct {
+	Head
+	OID  OID
+	Mark Mark
+}
+
+func (*SetMarkReq) Cmd() byte                                  { return V1_SET_MARK }
+func (*SetMarkReq) Mode() byte                                 { return V1_REQ }
+func (m *SetMarkReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SetMarkReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SetMarkReq) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	e.u32(uint32(m.Mark))
+	return nil
+}
+
+func (m *SetMarkReq) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.Mark = Mark(d.u32())
+}
+
+type SetMarkAck struct {
+	Head
+	OID  OID
+	Mark Mark
+}
+
+func (*SetMarkAck) Cmd() byte                                  { return V1_SET_MARK }
+func (*SetMarkAck) Mode() byte                                 { return V1_ACK }
+func (m *SetMarkAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SetMarkAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SetMarkAck) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	e.u32(uint32(m.Mark))
+	return nil
+}
+
+func (m *SetMarkAck) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.Mark = Mark(d.u32())
+}
+
+// Asks for the IpRef of an EA. The addrrecs have EA set, and the other
+// addresses set to the zero address of their version.
+type GetRefReq struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*GetRefReq) Cmd() byte                                  { return V1_GET_REF }
+func (*GetRefReq) Mode() byte                                 { return V1_REQ }
+func (m *GetRefReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *GetRefReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *GetRefReq) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *GetRefReq) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type GetRefAck struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*GetRefAck) Cmd() byte                                  { return V1_GET_REF }
+func (*GetRefAck) Mode() byte                                 { return V1_ACK }
+func (m *GetRefAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *GetRefAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *GetRefAck) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *GetRefAck) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+// Asks for the EA of an IpRef. The addrrecs have IP and Ref set, and EA and GW
+// set to the zero address of their version.
+type GetEAReq struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*GetEAReq) Cmd() byte                                  { return V1_GET_EA }
+func (*GetEAReq) Mode() byte                                 { return V1_REQ }
+func (m *GetEAReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *GetEAReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *GetEAReq) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *GetEAReq) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type GetEAAck struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*GetEAAck) Cmd() byte                                  { return V1_GET_EA }
+func (*GetEAAck) Mode() byte                                 { return V1_ACK }
+func (m *GetEAAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *GetEAAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *GetEAAck) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *GetEAAck) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type MCGetEAReq struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*MCGetEAReq) Cmd() byte                                  { return V1_MC_GET_EA }
+func (*MCGetEAReq) Mode() byte                                 { return V1_REQ }
+func (m *MCGetEAReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *MCGetEAReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *MCGetEAReq) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *MCGetEAReq) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type MCGetEAAck struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*MCGetEAAck) Cmd() byte                                  { return V1_MC_GET_EA }
+func (*MCGetEAAck) Mode() byte                                 { return V1_ACK }
+func (m *MCGetEAAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *MCGetEAAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *MCGetEAAck) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *MCGetEAAck) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type SaveOIDReq struct {
+	Head
+	OID  OID
+	Name string
+}
+
+func (*SaveOIDReq) Cmd() byte                                  { return V1_SAVE_OID }
+func (*SaveOIDReq) Mode() byte                                 { return V1_REQ }
+func (m *SaveOIDReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveOIDReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SaveOIDReq) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	return e.str(m.Name)
+}
+
+func (m *SaveOIDReq) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.Name = d.str()
+}
+
+type SaveOIDAck struct {
+	Head
+	OID OID
+}
+
+func (*SaveOIDAck) Cmd() byte                                  { return V1_SAVE_OID }
+func (*SaveOIDAck) Mode() byte                                 { return V1_ACK }
+func (m *SaveOIDAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveOIDAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *SaveOIDAck) encode(e *encoder) error { e.u32(uint32(m.OID)); return nil }
+func (m *SaveOIDAck) decode(d *decoder)       { m.OID = OID(d.u32()) }
+
+type SaveTimeBaseReq struct {
+	Head
+	OID      OID
+	TimeBase TimeBase
+}
+
+func (*SaveTimeBaseReq) Cmd() byte                                  { return V1_SAVE_TIME_BASE }
+func (*SaveTimeBaseReq) Mode() byte                                 { return V1_REQ }
+func (m *SaveTimeBaseReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveTimeBaseReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *SaveTimeBaseReq) encode(e *encoder) error {
+	e.u32(uint32(m.OID))
+	e.u64(uint64(m.TimeBase))
+	return nil
+}
+
+func (m *SaveTimeBaseReq) decode(d *decoder) {
+	m.OID = OID(d.u32())
+	m.TimeBase = TimeBase(d.u64())
+}
+
+type SaveTimeBaseAck struct {
+	Head
+	OID OID
+}
+
+func (*SaveTimeBaseAck) Cmd() byte                                  { return V1_SAVE_TIME_BASE }
+func (*SaveTimeBaseAck) Mode() byte                                 { return V1_ACK }
+func (m *SaveTimeBaseAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveTimeBaseAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *SaveTimeBaseAck) encode(e *encoder) error { e.u32(uint32(m.OID)); return nil }
+func (m *SaveTimeBaseAck) decode(d *decoder)       { m.OID = OID(d.u32()) }
+
+type RecoverEAReq struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*RecoverEAReq) Cmd() byte                                  { return V1_RECOVER_EA }
+func (*RecoverEAReq) Mode() byte                                 { return V1_REQ }
+func (m *RecoverEAReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *RecoverEAReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *RecoverEAReq) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *RecoverEAReq) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type RecoverEAAck struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*RecoverEAAck) Cmd() byte                                  { return V1_RECOVER_EA }
+func (*RecoverEAAck) Mode() byte                                 { return V1_ACK }
+func (m *RecoverEAAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *RecoverEAAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *RecoverEAAck) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *RecoverEAAck) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type RecoverRefReq struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*RecoverRefReq) Cmd() byte                                  { return V1_RECOVER_REF }
+func (*RecoverRefReq) Mode() byte                                 { return V1_REQ }
+func (m *RecoverRefReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *RecoverRefReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *RecoverRefReq) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *RecoverRefReq) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+type RecoverRefAck struct {
+	Head
+	AddrRecs []AddrRec
+}
+
+func (*RecoverRefAck) Cmd() byte                                  { return V1_RECOVER_REF }
+func (*RecoverRefAck) Mode() byte                                 { return V1_ACK }
+func (m *RecoverRefAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *RecoverRefAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *RecoverRefAck) encode(e *encoder) error { return e.arecs(m.AddrRecs) }
+func (m *RecoverRefAck) decode(d *decoder)       { m.AddrRecs = d.arecs() }
+
+// One packet of a batch of host data. Hash is of the whole batch.
+type HostData struct {
+	Head
+	BatchID  uint32
+	Hash     uint64
+	Source   string
+	AddrRecs []AddrRec
+}
+
+func (*HostData) Cmd() byte                                  { return V1_MC_HOST_DATA }
+func (*HostData) Mode() byte                                 { return V1_DATA }
+func (m *HostData) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *HostData) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *HostData) encode(e *encoder) error {
+	e.u32(m.BatchID)
+	e.u64(m.Hash)
+	if err := e.str(m.Source); err != nil {
+		return err
+	}
+	return e.arecs(m.AddrRecs)
+}
+
+func (m *HostData) decode(d *decoder) {
+	m.BatchID = d.u32()
+	m.Hash = d.u64()
+	m.Source = d.str()
+	m.AddrRecs = d.arecs()
+}
+
+type HostDataHashReq struct {
+	Head
+	Count  uint32
+	Hash   uint64
+	Source string
+}
+
+func (*HostDataHashReq) Cmd() byte                                  { return V1_MC_HOST_DATA_HASH }
+func (*HostDataHashReq) Mode() byte                                 { return V1_REQ }
+func (m *HostDataHashReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *HostDataHashReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *HostDataHashReq) encode(e *encoder) error {
+	e.u32(m.Count)
+	e.u64(m.Hash)
+	return e.str(m.Source)
+}
+
+func (m *HostDataHashReq) decode(d *decoder) {
+	m.Count = d.u32()
+	m.Hash = d.u64()
+	m.Source = d.str()
+}
+
+type HostDataHashAck struct {
+	Head
+	Count  uint32
+	Hash   uint64
+	Source string
+}
+
+func (*HostDataHashAck) Cmd() byte                                  { return V1_MC_HOST_DATA_HASH }
+func (*HostDataHashAck) Mode() byte                                 { return V1_ACK }
+func (m *HostDataHashAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *HostDataHashAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+
+func (m *HostDataHashAck) encode(e *encoder) error {
+	e.u32(m.Count)
+	e.u64(m.Hash)
+	return e.str(m.Source)
+}
+
+func (m *HostDataHashAck) decode(d *decoder) {
+	m.Count = d.u32()
+	m.Hash = d.u64()
+	m.Source = d.str()
+}
+
+// Only DNSSource.Mark is carried in the request.
+type SaveDNSSourceReq struct {
+	Head
+	DNSSource
+}
+
+func (*SaveDNSSourceReq) Cmd() byte                                  { return V1_SAVE_DNSSOURCE }
+func (*SaveDNSSourceReq) Mode() byte                                 { return V1_REQ }
+func (m *SaveDNSSourceReq) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveDNSSourceReq) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *SaveDNSSourceReq) encode(e *encoder) error { return e.dnssource(m.DNSSource, false) }
+func (m *SaveDNSSourceReq) decode(d *decoder)       { m.DNSSource = d.dnssource(false) }
+
+// Only DNSSource.XMark is carried in the ACK.
+type SaveDNSSourceAck struct {
+	Head
+	DNSSource
+}
+
+func (*SaveDNSSourceAck) Cmd() byte                                  { return V1_SAVE_DNSSOURCE }
+func (*SaveDNSSourceAck) Mode() byte                                 { return V1_ACK }
+func (m *SaveDNSSourceAck) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *SaveDNSSourceAck) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	return unmarshal(m, c, pkt)
+}
+func (m *SaveDNSSourceAck) encode(e *encoder) error { return e.dnssource(m.DNSSource, true) }
+func (m *SaveDNSSourceAck) decode(d *decoder)       { m.DNSSource = d.dnssource(true) }
+
+// Negative reply to a request of any command. Reason is optional.
+type Nack struct {
+	Head
+	Command byte
+	Reason  string
+}
+
+func (m *Nack) Cmd() byte                                { return m.Command }
+func (*Nack) Mode() byte                                 { return V1_NACK }
+func (m *Nack) MarshalV1(c AddrRecCodec) ([]byte, error) { return marshal(m, c) }
+func (m *Nack) UnmarshalV1(c AddrRecCodec, pkt []byte) error {
+	var hdr V1Header
+	if err := hdr.Unmarshal(pkt); err != nil {
+		return err
+	}
+	m.Command = hdr.Cmd // any command may be NACKed
+	return unmarshal(m, c, pkt)
+}
+
+func (m *Nack) encode(e *encoder) error {
+	if m.Reason == "" {
+		return nil
+	}
+	return e.str(m.Reason)
+}
+
+func (m *Nack) decode(d *decoder) {
+	if d.more() {
+		m.Reason = d.str()
+	}
+}
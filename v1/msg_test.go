@@ -0,0 +1,115 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"github.com/ipref/ref/oldv1"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func test_messages() []Message {
+
+	arecs4 := []AddrRec{
+		MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2"),
+		MustParseAddrRec("ea=10.240.0.6 ip=192.0.2.2 gw=8.8.8.8 ref=3"),
+	}
+	arecs6 := []AddrRec{
+		MustParseAddrRec("ea=fd00::5 ip=2001:db8::1 gw=8.8.4.4 ref=1-2"),
+	}
+	return []Message{
+		&NoopReq{Head{1}},
+		&NoopAck{Head{2}},
+		&SetAddrRecReq{Head{3}, 7, 1000, arecs4},
+		&SetAddrRecAck{Head{4}, 7, 1000},
+		&SetMarkReq{Head{5}, 7, 1001},
+		&SetMarkAck{Head{6}, 7, 1001},
+		&GetRefReq{Head{7}, arecs6},
+		&GetRefAck{Head{8}, arecs6},
+		&GetEAReq{Head{9}, arecs4[:1]},
+		&GetEAAck{Head{10}, arecs4[:1]},
+		&MCGetEAReq{Head{11}, arecs4},
+		&MCGetEAAck{Head{12}, arecs4},
+		&SaveOIDReq{Head{13}, 7, "mapper"},
+		&SaveOIDAck{Head{14}, 7},
+		&SaveTimeBaseReq{Head{15}, 7, TimeBase(1700000000)},
+		&SaveTimeBaseAck{Head{16}, 7},
+		&RecoverEAReq{Head{17}, arecs6},
+		&RecoverEAAck{Head{18}, arecs6},
+		&RecoverRefReq{Head{19}, arecs4},
+		&RecoverRefAck{Head{20}, arecs4},
+		&HostData{Head{21}, 3, 0x1122334455667788, "/etc/hosts", arecs4},
+		&HostDataHashReq{Head{22}, 2, 0x1122334455667788, "/etc/hosts"},
+		&HostDataHashAck{Head{23}, 2, 0x1122334455667788, "/etc/hosts"},
+		&SaveDNSSourceReq{Head{24}, DNSSource{OID: 7, Mark: 1002, Hash: 99, Source: "example.com"}},
+		&SaveDNSSourceAck{Head{25}, DNSSource{OID: 7, XMark: 1000, Hash: 99, Source: "example.com"}},
+		&Nack{Head{26}, V1_GET_EA, ""},
+		&Nack{Head{27}, V1_SET_AREC, "no such oid"},
+	}
+}
+
+func TestMessages(t *testing.T) {
+
+	for _, codec := range []AddrRecCodec{oldv1.Codec{}, newv1.Codec{}} {
+		for _, m := range test_messages() {
+			pkt, err := m.MarshalV1(codec)
+			if err != nil {
+				t.Errorf("%v %T: unexpected marshal error: %v", codec.Name(), m, err)
+				continue
+			}
+			if len(pkt) % 4 != 0 {
+				t.Errorf("%v %T: packet length %v not a multiple of 4", codec.Name(), m, len(pkt))
+			}
+			x, err := DecodeV1(pkt)
+			if err != nil {
+				t.Errorf("%v %T: unexpected decode error: %v", codec.Name(), m, err)
+				continue
+			}
+			if !reflect.DeepEqual(x, m) {
+				t.Errorf("%v: expected %+v, got %+v", codec.Name(), m, x)
+			}
+			if DetectCodec(pkt).Name() != codec.Name() && pkt[oldv1.V1_IPVER] != 0 {
+				t.Errorf("%v %T: detected as %v", codec.Name(), m, DetectCodec(pkt).Name())
+			}
+			// truncated packets must not panic, they may decode with fewer
+			// addrrecs, though
+			for i := V1_HDR_LEN; i < len(pkt); i += 4 {
+				trunc := append([]byte(nil), pkt[:i]...)
+				be.PutUint16(trunc[V1_PKTLEN:], uint16(i / 4))
+				if x, err := DecodeV1With(codec, trunc); err == nil && reflect.DeepEqual(x, m) {
+					t.Errorf("%v %T: %v bytes decoded as the whole message", codec.Name(), m, i)
+				}
+			}
+		}
+	}
+}
+
+func TestMessageErrors(t *testing.T) {
+
+	pkt, _ := (&SetMarkReq{Head{1}, 7, 8}).MarshalV1(newv1.Codec{})
+	if err := (&SetMarkAck{}).UnmarshalV1(newv1.Codec{}, pkt); !errors.Is(err, ErrUnexpectedMessage) {
+		t.Errorf("expected ErrUnexpectedMessage, got %v", err)
+	}
+	pkt = append(pkt, 0, 0, 0, 0)
+	be.PutUint16(pkt[V1_PKTLEN:], uint16(len(pkt) / 4))
+	if _, err := DecodeV1(pkt); !errors.Is(err, ErrV1Malformed) {
+		t.Errorf("expected ErrV1Malformed for trailing bytes, got %v", err)
+	}
+	mixed := &GetEAReq{AddrRecs: []AddrRec{
+		MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1"),
+		MustParseAddrRec("ea=fd00::5 ip=2001:db8::1 gw=8.8.4.4 ref=2"),
+	}}
+	if _, err := mixed.MarshalV1(oldv1.Codec{}); !errors.Is(err, ErrMixedAddrRecs) {
+		t.Errorf("expected ErrMixedAddrRecs for oldv1, got %v", err)
+	}
+	if _, err := mixed.MarshalV1(newv1.Codec{}); err != nil {
+		t.Errorf("unexpected error for newv1: %v", err)
+	}
+	long := &SaveOIDReq{Name: string(make([]byte, 256))}
+	if _, err := long.MarshalV1(newv1.Codec{}); !errors.Is(err, ErrV1ItemTooLong) {
+		t.Errorf("expected ErrV1ItemTooLong, got %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+/*
+ * ServeMux dispatches V1 requests to handlers registered per command. The
+ * handler's reply is sent as ACK, with the request's packet ID. A handler error
+ * is sent as NACK, with the error text as the reason. DATA packets get no
+ * reply. At most MaxConcurrent requests are handled at once, across all
+ * connections served by the mux.
+ */
+
+const DEFAULT_MAX_CONCURRENT = 64
+
+// Returns the ACK for the request, or an error to NACK it. The ACK's packet ID
+// is set by the caller. A nil ACK with a nil error is replaced with a zero ACK
+// of the request's command. For DATA requests, the ACK is discarded.
+type Handler interface {
+	ServeV1(ctx context.Context, req Message) (Message, error)
+}
+
+type HandlerFunc func(ctx context.Context, req Message) (Message, error)
+
+func (fn HandlerFunc) ServeV1(ctx context.Context, req Message) (Message, error) {
+	return fn(ctx, req)
+}
+
+type ServeMux struct {
+	MaxConcurrent int          // set before serving
+	Codec         AddrRecCodec // nil means reply in the version of the request
+
+	mu       sync.RWMutex
+	handlers map[byte]Handler
+	sem_once sync.Once
+	sem      chan struct{}
+}
+
+func NewServeMux() *ServeMux {
+	return &ServeMux{
+		MaxConcurrent: DEFAULT_MAX_CONCURRENT,
+		handlers:      make(map[byte]Handler),
+	}
+}
+
+func (mux *ServeMux) Handle(cmd byte, h Handler) {
+
+	if !V1CmdKnown(cmd) || cmd &^ V1_CMD_MASK != 0 {
+		panic(fmt.Sprintf("invalid V1 command: %v", cmd))
+	}
+	mux.mu.Lock()
+	mux.handlers[cmd] = h
+	mux.mu.Unlock()
+}
+
+func (mux *ServeMux) HandleFunc(cmd byte, fn func(ctx context.Context, req Message) (Message, error)) {
+	mux.Handle(cmd, HandlerFunc(fn))
+}
+
+// Dispatches the request to the handler of its command. Implements Handler.
+func (mux *ServeMux) ServeV1(ctx context.Context, req Message) (Message, error) {
+
+	mux.mu.RLock()
+	h, ok := mux.handlers[req.Cmd()]
+	mux.mu.RUnlock()
+	if !ok {
+		return nil, errors.New("no handler for " + V1CmdName(req.Cmd()))
+	}
+	return h.ServeV1(ctx, req)
+}
+
+// Accepts connections and serves each until it closes. Returns the error of
+// Accept, eg. when the listener is closed.
+func (mux *ServeMux) Serve(l net.Listener) error {
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			mux.ServeConn(conn)
+			conn.Close()
+		}()
+	}
+}
+
+// Serves requests arriving on the stream connection until it fails. Returns
+// the read error.
+func (mux *ServeMux) ServeConn(conn net.Conn) error {
+
+	mux.sem_once.Do(func() {
+		mux.sem = make(chan struct{}, max(mux.MaxConcurrent, 1))
+	})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // before waiting for the handlers
+	r := NewReader(conn)
+	w := NewWriter(conn)
+	for {
+		pkt, err := r.ReadPacket()
+		if err != nil {
+			return err
+		}
+		var hdr V1Header
+		if hdr.Unmarshal(pkt) != nil || (hdr.Mode != V1_REQ && hdr.Mode != V1_DATA) {
+			continue // replies and unknown commands are dropped
+		}
+		codec := mux.Codec
+		if codec == nil {
+			codec = DetectCodec(pkt)
+		}
+		req, err := DecodeV1With(codec, pkt)
+		if err != nil {
+			if hdr.Mode == V1_REQ {
+				nack := &Nack{Head{hdr.PktID}, hdr.Cmd, err.Error()}
+				pkt, err := nack.MarshalV1(codec)
+				if err == nil {
+					w.WritePacket(pkt)
+				}
+			}
+			continue
+		}
+		mux.sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-mux.sem }()
+			ack := mux.handle(ctx, req)
+			if ack == nil {
+				return
+			}
+			pkt, err := ack.MarshalV1(codec)
+			if err != nil {
+				nack := nack_reply(req, fmt.Errorf("cannot encode ACK: %w", err))
+				if pkt, err = nack.MarshalV1(codec); err != nil {
+					return
+				}
+			}
+			if err := w.WritePacket(pkt); err != nil {
+				conn.Close() // the reader fails next and ends the loop
+			}
+		}()
+	}
+}
+
+// Runs the handler, and returns the reply to send, if any.
+func (mux *ServeMux) handle(ctx context.Context, req Message) (ack Message) {
+
+	defer func() {
+		if r := recover(); r != nil {
+			ack = nack_reply(req, fmt.Errorf("handler panic: %v", r))
+		}
+	}()
+	ack, err := mux.ServeV1(ctx, req)
+	if req.Mode() != V1_REQ {
+		return nil
+	}
+	if err != nil {
+		return nack_reply(req, err)
+	}
+	if ack == nil {
+		ack = NewMessage(req.Cmd(), V1_ACK)
+		if ack == nil {
+			return nack_reply(req, errors.New("no ACK for " + V1CmdName(req.Cmd())))
+		}
+	}
+	if ack.Cmd() != req.Cmd() || (ack.Mode() != V1_ACK && ack.Mode() != V1_NACK) {
+		return nack_reply(req, fmt.Errorf("handler replied with %v %v",
+			V1CmdName(ack.Cmd()), V1ModeName(ack.Mode())))
+	}
+	ack.SetID(req.ID())
+	return ack
+}
+
+func nack_reply(req Message, err error) Message {
+
+	if req.Mode() != V1_REQ {
+		return nil
+	}
+	reason := err.Error()
+	var nerr *NackError
+	if errors.As(err, &nerr) {
+		reason = nerr.Reason
+	}
+	if len(reason) > 255 {
+		reason = reason[:255]
+	}
+	return &Nack{Head{req.ID()}, req.Cmd(), reason}
+}
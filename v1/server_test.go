@@ -0,0 +1,122 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestServeMux(t *testing.T) {
+
+	arec := MustParseAddrRec("ea=10.240.0.5 ip=192.0.2.1 gw=8.8.4.4 ref=1-2")
+	var running, peak atomic.Int32
+	mux := NewServeMux()
+	mux.MaxConcurrent = 2
+	mux.HandleFunc(V1_GET_EA, func(ctx context.Context, req Message) (Message, error) {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		if req.(*GetEAReq).AddrRecs[0].IpRef() != arec.IpRef() {
+			return nil, errors.New("unknown ipref")
+		}
+		return &GetEAAck{AddrRecs: []AddrRec{arec}}, nil
+	})
+	mux.HandleFunc(V1_SET_MARK, func(ctx context.Context, req Message) (Message, error) {
+		return nil, nil // zero ACK
+	})
+	mux.HandleFunc(V1_GET_REF, func(ctx context.Context, req Message) (Message, error) {
+		panic("boom")
+	})
+	mux.HandleFunc(V1_RECOVER_EA, func(ctx context.Context, req Message) (Message, error) {
+		return &RecoverEAAck{AddrRecs: []AddrRec{{}}}, nil // doesn't encode
+	})
+
+	a, b := net.Pipe()
+	go mux.ServeConn(b)
+	c := NewClient(a)
+	defer c.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ea, err := c.GetEA(ctx, arec.IpRef()); err != nil || ea != arec.EA {
+				t.Errorf("expected %v, got %v %v", arec.EA, ea, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak.Load() > 2 {
+		t.Errorf("expected at most 2 concurrent handlers, got %v", peak.Load())
+	}
+
+	var nack *NackError
+	if _, err := c.GetEA(ctx, IpRef{IP: MustParseIP("192.0.2.9"), Ref: Ref{L: 1}}); !errors.As(err, &nack) || nack.Reason != "unknown ipref" {
+		t.Errorf("expected NACK with reason, got %v", err)
+	}
+	if m, err := c.Do(ctx, &SetMarkReq{OID: 1, Mark: 2}); err != nil || m.Mode() != V1_ACK {
+		t.Errorf("expected zero ACK, got %v %v", m, err)
+	}
+	if _, err := c.GetRef(ctx, arec.EA); !errors.As(err, &nack) || nack.Cmd != V1_GET_REF {
+		t.Errorf("expected NACK after panic, got %v", err)
+	}
+	if _, err := c.Do(ctx, &SaveOIDReq{OID: 1, Name: "x"}); !errors.As(err, &nack) {
+		t.Errorf("expected NACK without handler, got %v", err)
+	}
+	if _, err := c.Do(ctx, &RecoverEAReq{AddrRecs: []AddrRec{arec}}); !errors.As(err, &nack) ||
+		nack.Cmd != V1_RECOVER_EA {
+
+		t.Errorf("expected NACK for an ACK which doesn't encode, got %v", err)
+	}
+	if m, err := c.Do(ctx, &SetMarkReq{OID: 1, Mark: 3}); err != nil || m.Mode() != V1_ACK {
+		t.Errorf("connection unusable after an ACK which doesn't encode: %v %v", m, err)
+	}
+}
+
+func TestServeMuxListener(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "v1.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skipf("cannot listen on unix socket: %v", err)
+	}
+	mux := NewServeMux()
+	mux.HandleFunc(V1_NOOP, func(ctx context.Context, req Message) (Message, error) {
+		return &NoopAck{}, nil
+	})
+	done := make(chan error, 1)
+	go func() { done <- mux.Serve(l) }()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	c := NewClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+	defer cancel()
+	if _, err := c.Do(ctx, &NoopReq{}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	c.Close()
+	l.Close()
+	if err := <-done; err == nil {
+		t.Errorf("expected Serve to fail after listener closed")
+	}
+}
@@ -0,0 +1,268 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+/*
+ * Framing of V1 packets on stream sockets. A read may return part of a packet,
+ * or several packets. Reader splits the stream by V1_PKTLEN, Writer writes each
+ * packet with a single Write. Errors of the underlying reader or writer,
+ * including deadline errors, are returned as is. A read interrupted by a
+ * deadline may be retried, the partial packet is kept. Problems with the stream
+ * itself are returned as *FrameError.
+ */
+
+const DEFAULT_MAX_PKT_LEN = 64 * 1024
+
+var (
+	ErrPktTooLarge = errors.New("V1 packet larger than maximum")
+	ErrNoDeadline  = errors.New("underlying connection does not support deadlines")
+)
+
+type FrameError struct {
+	Offset int64 // in the stream, of the offending header
+	Err    error // ErrV1Sig, ErrV1PktLen, ErrPktTooLarge or io.ErrUnexpectedEOF
+}
+
+func (e *FrameError) Error() string {
+	return fmt.Sprintf("V1 framing error at offset %v: %v", e.Offset, e.Err)
+}
+
+func (e *FrameError) Unwrap() error {
+	return e.Err
+}
+
+type Reader struct {
+	MaxPktLen int          // packets longer than this are framing errors
+	Resync    bool         // on a bad header, skip to the next plausible one instead of failing
+	Codec     AddrRecCodec // for ReadMessage, nil means detect per packet
+
+	r         io.Reader
+	buf       []byte
+	start     int   // of unread data in buf
+	end       int   // of unread data in buf
+	last      int   // length of the packet returned previously, still at start
+	offset    int64 // in the stream, of buf[start]
+	discarded int64
+	rerr      error // from the underlying reader, held until buffered data is used
+	ferr      error // sticky framing error
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{MaxPktLen: DEFAULT_MAX_PKT_LEN, r: r}
+}
+
+// Returns the next packet. It is valid until the next call. After a framing
+// error, unless Resync is set, all calls return the same error.
+func (r *Reader) ReadPacket() ([]byte, error) {
+
+	if r.ferr != nil {
+		return nil, r.ferr
+	}
+	r.advance(r.last)
+	r.last = 0
+	for {
+		need := V1_HDR_LEN
+		if r.end - r.start >= V1_HDR_LEN {
+			pktlen, err := r.check(r.buf[r.start:r.end])
+			if err != nil {
+				if !r.Resync {
+					r.ferr = &FrameError{r.offset, err}
+					return nil, r.ferr
+				}
+				r.skip()
+				continue
+			}
+			if r.end - r.start >= pktlen {
+				r.last = pktlen
+				return r.buf[r.start:r.start+pktlen], nil
+			}
+			need = pktlen
+		}
+		if err := r.fill(need); err != nil {
+			if err == io.EOF && r.end > r.start {
+				r.ferr = &FrameError{r.offset, io.ErrUnexpectedEOF}
+				return nil, r.ferr
+			}
+			return nil, err
+		}
+	}
+}
+
+// Reads and decodes the next packet.
+func (r *Reader) ReadMessage() (Message, error) {
+
+	pkt, err := r.ReadPacket()
+	if err != nil {
+		return nil, err
+	}
+	if r.Codec != nil {
+		return DecodeV1With(r.Codec, pkt)
+	}
+	return DecodeV1(pkt)
+}
+
+// Returns the number of bytes skipped while resynchronizing.
+func (r *Reader) Discarded() int64 {
+	return r.discarded
+}
+
+func (r *Reader) SetReadDeadline(t time.Time) error {
+
+	if d, ok := r.r.(interface{ SetReadDeadline(time.Time) error }); ok {
+		return d.SetReadDeadline(t)
+	}
+	return ErrNoDeadline
+}
+
+// Returns the length of the packet whose header starts hdr. While
+// resynchronizing, the command must also be known.
+func (r *Reader) check(hdr []byte) (int, error) {
+
+	if hdr[V1_VER] != V1_SIG {
+		return 0, ErrV1Sig
+	}
+	pktlen := int(be.Uint16(hdr[V1_PKTLEN:V1_PKTLEN+2])) * V1_PKTLEN_UNIT
+	if pktlen < V1_HDR_LEN {
+		return 0, ErrV1PktLen
+	}
+	if pktlen > r.MaxPktLen {
+		return 0, ErrPktTooLarge
+	}
+	if r.Resync && !V1CmdKnown(hdr[V1_CMD]) {
+		return 0, ErrV1UnknownCmd
+	}
+	return pktlen, nil
+}
+
+// Drops the byte at start and everything up to the next V1_SIG.
+func (r *Reader) skip() {
+
+	n := 1
+	if i := bytes.IndexByte(r.buf[r.start+1:r.end], V1_SIG); i >= 0 {
+		n += i
+	} else {
+		n = r.end - r.start
+	}
+	r.advance(n)
+	r.discarded += int64(n)
+}
+
+func (r *Reader) advance(n int) {
+
+	r.start += n
+	r.offset += int64(n)
+	if r.start == r.end {
+		r.start, r.end = 0, 0
+	}
+}
+
+// Reads at least once, unless need bytes are buffered already.
+func (r *Reader) fill(need int) error {
+
+	if r.rerr != nil {
+		err := r.rerr
+		r.rerr = nil
+		return err
+	}
+	if r.start + need > len(r.buf) {
+		if need > len(r.buf) {
+			buf := make([]byte, max(need, 4096))
+			r.end = copy(buf, r.buf[r.start:r.end])
+			r.buf = buf
+		} else {
+			r.end = copy(r.buf, r.buf[r.start:r.end])
+		}
+		r.start = 0
+	}
+	n, err := r.r.Read(r.buf[r.end:])
+	r.end += n
+	if n > 0 {
+		r.rerr = err
+		return nil
+	}
+	if err == nil {
+		err = io.ErrNoProgress
+	}
+	return err
+}
+
+// Writer is safe for concurrent use.
+type Writer struct {
+	MaxPktLen int
+	Codec     AddrRecCodec // for WriteMessage, nil means newv1
+
+	mu  sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{MaxPktLen: DEFAULT_MAX_PKT_LEN, w: w}
+}
+
+// Writes one whole packet. Its header is validated.
+func (w *Writer) WritePacket(pkt []byte) error {
+
+	var hdr V1Header
+	if err := hdr.UnmarshalPacket(pkt); err != nil {
+		return err
+	}
+	if len(pkt) > w.MaxPktLen {
+		return ErrPktTooLarge
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.write(pkt)
+}
+
+func (w *Writer) WriteMessage(m Message) error {
+
+	codec := w.Codec
+	if codec == nil {
+		codec = newv1.Codec{}
+	}
+	return w.WriteMessageWith(m, codec)
+}
+
+func (w *Writer) WriteMessageWith(m Message, codec AddrRecCodec) error {
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	pkt, err := AppendV1(w.buf[:0], m, codec)
+	if err != nil {
+		return err
+	}
+	w.buf = pkt
+	if len(pkt) > w.MaxPktLen {
+		return ErrPktTooLarge
+	}
+	return w.write(pkt)
+}
+
+func (w *Writer) write(pkt []byte) error {
+
+	n, err := w.w.Write(pkt)
+	if err == nil && n != len(pkt) {
+		err = io.ErrShortWrite
+	}
+	return err
+}
+
+func (w *Writer) SetWriteDeadline(t time.Time) error {
+
+	if d, ok := w.w.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		return d.SetWriteDeadline(t)
+	}
+	return ErrNoDeadline
+}
@@ -0,0 +1,144 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package v1
+
+import (
+	. "github.com/ipref/ref"
+	"github.com/ipref/ref/newv1"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	msgs := test_messages()
+	var stream []byte
+	for _, m := range msgs {
+		pkt, err := m.MarshalV1(newv1.Codec{})
+		if err != nil {
+			t.Fatalf("%T: unexpected marshal error: %v", m, err)
+		}
+		stream = append(stream, pkt...)
+	}
+	// write in odd-sized chunks, so reads see partial and multiple packets
+	go func() {
+		for i := 0; i < len(stream); i += 37 {
+			a.Write(stream[i:min(i + 37, len(stream))])
+		}
+		a.Close()
+	}()
+	r := NewReader(b)
+	for _, m := range msgs {
+		x, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("%T: unexpected read error: %v", m, err)
+		}
+		if !reflect.DeepEqual(x, m) {
+			t.Errorf("expected %+v, got %+v", m, x)
+		}
+	}
+	if _, err := r.ReadPacket(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+}
+
+func TestStreamWriter(t *testing.T) {
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	w := NewWriter(a)
+	r := NewReader(b)
+	go func() {
+		for _, m := range test_messages() {
+			w.WriteMessage(m)
+		}
+	}()
+	for _, m := range test_messages() {
+		x, err := r.ReadMessage()
+		if err != nil || !reflect.DeepEqual(x, m) {
+			t.Fatalf("expected %+v, got %+v %v", m, x, err)
+		}
+	}
+	w.MaxPktLen = 8
+	if err := w.WriteMessage(&SaveOIDReq{OID: 1, Name: "x"}); !errors.Is(err, ErrPktTooLarge) {
+		t.Errorf("expected ErrPktTooLarge, got %v", err)
+	}
+	if err := w.WritePacket([]byte{V1_SIG, 0, 0, 0}); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("expected ErrShortBuffer, got %v", err)
+	}
+}
+
+func TestStreamDeadline(t *testing.T) {
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	pkt, _ := (&SetMarkReq{Head{1}, 7, 8}).MarshalV1(newv1.Codec{})
+	r := NewReader(b)
+	go a.Write(pkt[:5])
+	r.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if _, err := r.ReadPacket(); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	go a.Write(pkt[5:])
+	r.SetReadDeadline(time.Time{})
+	x, err := r.ReadPacket()
+	if err != nil || !bytes.Equal(x, pkt) {
+		t.Errorf("expected % x after retry, got % x %v", pkt, x, err)
+	}
+}
+
+func TestStreamBadSig(t *testing.T) {
+
+	pkt, _ := (&SetMarkReq{Head{1}, 7, 8}).MarshalV1(newv1.Codec{})
+	garbage := []byte{1, 2, V1_SIG, 3, 4, 5, 6, 7, 8, 9}
+	stream := append(append(append([]byte(nil), pkt...), garbage...), pkt...)
+
+	r := NewReader(bytes.NewReader(stream))
+	if _, err := r.ReadPacket(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err := r.ReadPacket()
+	var ferr *FrameError
+	if !errors.As(err, &ferr) || !errors.Is(err, ErrV1Sig) || ferr.Offset != int64(len(pkt)) {
+		t.Fatalf("expected FrameError at %v, got %v", len(pkt), err)
+	}
+	if _, err2 := r.ReadPacket(); err2 != err {
+		t.Errorf("expected sticky error, got %v", err2)
+	}
+
+	r = NewReader(bytes.NewReader(stream))
+	r.Resync = true
+	for i := 0; i < 2; i++ {
+		x, err := r.ReadPacket()
+		if err != nil || !bytes.Equal(x, pkt) {
+			t.Fatalf("packet %v: expected % x, got % x %v", i, pkt, x, err)
+		}
+	}
+	if r.Discarded() != int64(len(garbage)) {
+		t.Errorf("expected %v discarded bytes, got %v", len(garbage), r.Discarded())
+	}
+
+	r = NewReader(bytes.NewReader(pkt[:len(pkt)-1]))
+	if _, err := r.ReadPacket(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected ErrUnexpectedEOF, got %v", err)
+	}
+	r = NewReader(bytes.NewReader(pkt))
+	r.MaxPktLen = 8
+	if _, err := r.ReadPacket(); !errors.Is(err, ErrPktTooLarge) {
+		t.Errorf("expected ErrPktTooLarge, got %v", err)
+	}
+}
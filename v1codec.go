@@ -0,0 +1,99 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import "errors"
+
+// The addrrec format of one version of the V1 protocol. Implemented by
+// oldv1.Codec and newv1.Codec.
+type AddrRecCodec interface {
+	Name() string // "oldv1" or "newv1"
+	EncodedLen(arec AddrRec) (int, error)
+	// Encodes the addrrec at the start of dst, returns the encoded length.
+	Encode(dst []byte, arec AddrRec) (int, error)
+	// Decodes the addrrec at the start of src, returns the decoded length. hdr
+	// is the header of the packet the addrrec came from.
+	Decode(hdr, src []byte) (int, AddrRec, error)
+	// Sets the version-specific header fields (V1_IPVER or V1_RESERVED) for a
+	// packet carrying addrrecs in the same format as arec.
+	SetHeader(hdr []byte, arec AddrRec) error
+}
+
+var ErrV1Malformed = errors.New("malformed V1 packet")
+
+// Returns the payload offset of the addrrecs of V1 commands which carry them.
+func V1AddrRecOffset(cmd byte) (int, bool) {
+
+	switch cmd & V1_CMD_MASK {
+	case V1_SET_AREC:
+		return V1_MARK_LEN, true
+	case V1_GET_REF, V1_GET_EA, V1_MC_GET_EA, V1_RECOVER_EA, V1_RECOVER_REF:
+		return 0, true
+	}
+	return 0, false
+}
+
+// Rewrites a whole V1 packet from one addrrec format to another. The header is
+// adjusted, and all addrrecs are re-encoded. Packets of commands without
+// addrrecs are copied with only the header adjusted.
+func ConvertV1Packet(pkt []byte, from, to AddrRecCodec) ([]byte, error) {
+
+	var h V1Header
+	if err := h.Unmarshal(pkt); err != nil || h.PktLen > len(pkt) {
+		return nil, ErrV1Malformed
+	}
+	pktlen := h.PktLen
+	pkt = pkt[:pktlen]
+	hdr := pkt[:V1_HDR_LEN]
+	out := make([]byte, V1_HDR_LEN, pktlen + pktlen / V1_PKTLEN_UNIT)
+	copy(out, hdr)
+	clear(out[V1_PKTID+2:V1_PKTLEN]) // oldv1 V1_IPVER or newv1 V1_RESERVED
+
+	offset, ok := V1AddrRecOffset(pkt[V1_CMD])
+	if !ok || len(pkt) == V1_HDR_LEN {
+		out = append(out, pkt[V1_HDR_LEN:]...)
+		return out, nil
+	}
+	payload := pkt[V1_HDR_LEN:]
+	if len(payload) < offset {
+		return nil, ErrV1Malformed
+	}
+	out = append(out, payload[:offset]...)
+	first := true
+	for i := offset; i < len(payload); {
+		length, arec, err := from.Decode(hdr, payload[i:])
+		if err != nil {
+			return nil, err
+		}
+		i += length
+		if first {
+			if err := to.SetHeader(out[:V1_HDR_LEN], arec); err != nil {
+				return nil, err
+			}
+			first = false
+		}
+		enclen, err := to.EncodedLen(arec)
+		if err != nil {
+			return nil, err
+		}
+		start := len(out)
+		out = append(out, make([]byte, enclen)...)
+		if _, err := to.Encode(out[start:], arec); err != nil {
+			return nil, err
+		}
+		// all addrrecs must fit the header set for the first one
+		x := make([]byte, V1_HDR_LEN)
+		copy(x, out[:V1_HDR_LEN])
+		if err := to.SetHeader(x, arec); err != nil {
+			return nil, err
+		}
+		if string(x) != string(out[:V1_HDR_LEN]) {
+			return nil, errors.New("addrrecs in packet don't share a format")
+		}
+	}
+	if len(out) % V1_PKTLEN_UNIT != 0 || len(out) > V1_MAX_PKT_LEN {
+		return nil, ErrV1Malformed
+	}
+	be.PutUint16(out[V1_PKTLEN:V1_PKTLEN+2], uint16(len(out) / V1_PKTLEN_UNIT))
+	return out, nil
+}
@@ -0,0 +1,136 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"fmt"
+)
+
+const ( // v1 header fields
+
+	V1_CMD_MASK    = 0x3f // command, low six bits of V1_CMD
+	V1_MODE_MASK   = 0xc0 // mode, top two bits of V1_CMD
+	V1_PKTLEN_UNIT = 4    // V1_PKTLEN is in 4-byte words
+	V1_MAX_PKT_LEN = 0xffff * V1_PKTLEN_UNIT
+)
+
+var (
+	ErrV1Sig        = errors.New("V1 packet has invalid signature")
+	ErrV1PktLen     = errors.New("V1 packet has invalid length")
+	ErrV1UnknownCmd = errors.New("V1 packet has unknown command")
+)
+
+var v1_cmd_names = map[byte]string{
+	V1_NOOP:              "NOOP",
+	V1_SET_AREC:          "SET_AREC",
+	V1_SET_MARK:          "SET_MARK",
+	V1_GET_REF:           "GET_REF",
+	V1_GET_EA:            "GET_EA",
+	V1_MC_GET_EA:         "MC_GET_EA",
+	V1_SAVE_OID:          "SAVE_OID",
+	V1_SAVE_TIME_BASE:    "SAVE_TIME_BASE",
+	V1_RECOVER_EA:        "RECOVER_EA",
+	V1_RECOVER_REF:       "RECOVER_REF",
+	V1_MC_HOST_DATA:      "MC_HOST_DATA",
+	V1_MC_HOST_DATA_HASH: "MC_HOST_DATA_HASH",
+	V1_SAVE_DNSSOURCE:    "SAVE_DNSSOURCE",
+}
+
+var v1_mode_names = [4]string{"DATA", "REQ", "ACK", "NACK"}
+
+func V1CmdName(cmd byte) string {
+
+	if name, ok := v1_cmd_names[cmd & V1_CMD_MASK]; ok {
+		return name
+	}
+	return fmt.Sprintf("CMD(%d)", cmd & V1_CMD_MASK)
+}
+
+func V1ModeName(mode byte) string {
+	return v1_mode_names[(mode & V1_MODE_MASK) >> 6]
+}
+
+func V1CmdKnown(cmd byte) bool {
+
+	_, ok := v1_cmd_names[cmd & V1_CMD_MASK]
+	return ok
+}
+
+// The 8-byte header of V1 packets
+type V1Header struct {
+	Cmd    byte   // without the mode bits
+	Mode   byte   // V1_DATA, V1_REQ, V1_ACK or V1_NACK
+	PktID  uint16
+	IPVer  byte   // oldv1 only: V1_IPVER, ea IP ver in high nibble, gw IP ver in low
+	PktLen int    // in bytes, including the header; a multiple of V1_PKTLEN_UNIT
+}
+
+// Encodes the header into the first V1_HDR_LEN bytes of b.
+func (h V1Header) Marshal(b []byte) error {
+
+	if len(b) < V1_HDR_LEN {
+		return ErrShortBuffer
+	}
+	if h.Cmd &^ V1_CMD_MASK != 0 || h.Mode &^ V1_MODE_MASK != 0 {
+		return ErrV1UnknownCmd
+	}
+	if h.PktLen < V1_HDR_LEN || h.PktLen > V1_MAX_PKT_LEN || h.PktLen % V1_PKTLEN_UNIT != 0 {
+		return ErrV1PktLen
+	}
+	b[V1_VER] = V1_SIG
+	b[V1_CMD] = h.Cmd | h.Mode
+	be.PutUint16(b[V1_PKTID:V1_PKTID+2], h.PktID)
+	b[V1_PKTID+2] = h.IPVer // oldv1 V1_IPVER
+	b[V1_PKTID+3] = 0       // oldv1 V1_RESERVED, newv1 V1_RESERVED low byte
+	be.PutUint16(b[V1_PKTLEN:V1_PKTLEN+2], uint16(h.PktLen / V1_PKTLEN_UNIT))
+	return nil
+}
+
+// Decodes and validates the header at the start of b. Only the header needs to
+// be present; use UnmarshalPacket to also check the packet length.
+func (h *V1Header) Unmarshal(b []byte) error {
+
+	if len(b) < V1_HDR_LEN {
+		return ErrShortBuffer
+	}
+	if b[V1_VER] != V1_SIG {
+		return ErrV1Sig
+	}
+	pktlen := int(be.Uint16(b[V1_PKTLEN:V1_PKTLEN+2])) * V1_PKTLEN_UNIT
+	if pktlen < V1_HDR_LEN {
+		return ErrV1PktLen
+	}
+	if !V1CmdKnown(b[V1_CMD]) {
+		return ErrV1UnknownCmd
+	}
+	*h = V1Header{
+		Cmd:    b[V1_CMD] & V1_CMD_MASK,
+		Mode:   b[V1_CMD] & V1_MODE_MASK,
+		PktID:  be.Uint16(b[V1_PKTID:V1_PKTID+2]),
+		IPVer:  b[V1_PKTID+2],
+		PktLen: pktlen,
+	}
+	return nil
+}
+
+// Like Unmarshal, but pkt must be exactly one whole packet.
+func (h *V1Header) UnmarshalPacket(pkt []byte) error {
+
+	if err := h.Unmarshal(pkt); err != nil {
+		return err
+	}
+	if h.PktLen != len(pkt) {
+		return ErrV1PktLen
+	}
+	return nil
+}
+
+func (h V1Header) String() string {
+
+	s := fmt.Sprintf("%v %v id=%v len=%v", V1CmdName(h.Cmd), V1ModeName(h.Mode), h.PktID, h.PktLen)
+	if h.IPVer != 0 {
+		s += fmt.Sprintf(" ipver=%02x", h.IPVer)
+	}
+	return s
+}
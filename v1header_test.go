@@ -0,0 +1,58 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestV1Header(t *testing.T) {
+
+	h := V1Header{Cmd: V1_GET_EA, Mode: V1_ACK, PktID: 0x1234, IPVer: 0x44, PktLen: 28}
+	b := make([]byte, V1_HDR_LEN)
+	if err := h.Marshal(b); err != nil {
+		t.Fatalf("unexpected marshal error: %v", err)
+	}
+	expected := []byte{V1_SIG, V1_GET_EA | V1_ACK, 0x12, 0x34, 0x44, 0, 0, 7}
+	if string(b) != string(expected) {
+		t.Errorf("expected % x, got % x", expected, b)
+	}
+	var x V1Header
+	if err := x.Unmarshal(b); err != nil || x != h {
+		t.Errorf("expected %v, got %v %v", h, x, err)
+	}
+	if s := h.String(); s != "GET_EA ACK id=4660 len=28 ipver=44" {
+		t.Errorf("unexpected string %q", s)
+	}
+	if err := x.UnmarshalPacket(b); !errors.Is(err, ErrV1PktLen) {
+		t.Errorf("expected ErrV1PktLen for truncated packet, got %v", err)
+	}
+	if err := x.UnmarshalPacket(append(b, make([]byte, 20)...)); err != nil {
+		t.Errorf("unexpected error for whole packet: %v", err)
+	}
+
+	test_cases := []struct {
+		b   []byte
+		err error
+	}{
+		{[]byte{V1_SIG, V1_GET_EA, 0, 0, 0, 0, 0}, ErrShortBuffer},
+		{[]byte{0x12, V1_GET_EA, 0, 0, 0, 0, 0, 2}, ErrV1Sig},
+		{[]byte{V1_SIG, V1_GET_EA, 0, 0, 0, 0, 0, 1}, ErrV1PktLen},
+		{[]byte{V1_SIG, 3 | V1_REQ, 0, 0, 0, 0, 0, 2}, ErrV1UnknownCmd},
+	}
+	for i, c := range test_cases {
+		if err := x.Unmarshal(c.b); !errors.Is(err, c.err) {
+			t.Errorf("case %v: expected %v, got %v", i, c.err, err)
+		}
+	}
+	for _, h := range []V1Header{
+		{Cmd: V1_NOOP, PktLen: 6},
+		{Cmd: V1_NOOP, PktLen: V1_MAX_PKT_LEN + 4},
+		{Cmd: V1_NACK, PktLen: 8},
+	} {
+		if err := h.Marshal(b); err == nil {
+			t.Errorf("expected error marshaling %v", h)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+/*
+ * V1 items are type-length-value records within V1 payloads. The header is a
+ * type byte followed by a length byte, the length of the value alone. The item
+ * is padded with zeros to a multiple of 4 bytes. Item types are registered with
+ * RegisterV1Item, each with functions converting between the value bytes and a
+ * Go value:
+ *
+ *	V1_TYPE_NONE    nil, empty value
+ *	V1_TYPE_AREC    AddrRec, registered by package newv1 in the newv1 format
+ *	V1_TYPE_IPV4    IP
+ *	V1_TYPE_STRING  string
+ *
+ * Values of unregistered types decode as []byte.
+ */
+
+const V1_ITEM_HDR_LEN = 2
+
+var (
+	ErrV1ItemType    = errors.New("unknown V1 item type")
+	ErrV1ItemValue   = errors.New("invalid value for V1 item type")
+	ErrV1ItemTooLong = errors.New("V1 item value longer than 255 bytes")
+)
+
+type V1ItemType struct {
+	Name   string
+	Encode func(dst []byte, val any) ([]byte, error) // appends the value bytes
+	Decode func(val []byte) (any, error)
+}
+
+var v1_items = struct {
+	mu    sync.RWMutex
+	types map[byte]V1ItemType
+}{types: make(map[byte]V1ItemType)}
+
+// Registers an item type. Panics if the type is already registered.
+func RegisterV1Item(typ byte, it V1ItemType) {
+
+	v1_items.mu.Lock()
+	defer v1_items.mu.Unlock()
+	if _, ok := v1_items.types[typ]; ok {
+		panic(fmt.Sprintf("V1 item type %v already registered", typ))
+	}
+	v1_items.types[typ] = it
+}
+
+// Removes a registered item type, for tests.
+func unregister_v1_item(typ byte) {
+
+	v1_items.mu.Lock()
+	defer v1_items.mu.Unlock()
+	delete(v1_items.types, typ)
+}
+
+func LookupV1Item(typ byte) (V1ItemType, bool) {
+
+	v1_items.mu.RLock()
+	defer v1_items.mu.RUnlock()
+	it, ok := v1_items.types[typ]
+	return it, ok
+}
+
+func V1ItemName(typ byte) string {
+
+	if it, ok := LookupV1Item(typ); ok {
+		return it.Name
+	}
+	return fmt.Sprintf("TYPE(%d)", typ)
+}
+
+// Returns the encoded length of an item with a value of vlen bytes, including
+// the header and padding.
+func V1ItemLen(vlen int) int {
+	return (V1_ITEM_HDR_LEN + vlen + 3) &^ 3
+}
+
+// Appends the item to dst. Values of type []byte are appended as is, for any
+// item type.
+func AppendV1Item(dst []byte, typ byte, val any) ([]byte, error) {
+
+	start := len(dst)
+	dst = append(dst, typ, 0)
+	var err error
+	if raw, ok := val.([]byte); ok {
+		dst = append(dst, raw...)
+	} else if it, ok := LookupV1Item(typ); ok {
+		dst, err = it.Encode(dst, val)
+	} else {
+		err = ErrV1ItemType
+	}
+	if err != nil {
+		return dst[:start], err
+	}
+	vlen := len(dst) - start - V1_ITEM_HDR_LEN
+	if vlen > 255 {
+		return dst[:start], ErrV1ItemTooLong
+	}
+	dst[start+1] = byte(vlen)
+	for (len(dst) - start) % 4 != 0 {
+		dst = append(dst, 0)
+	}
+	return dst, nil
+}
+
+// Decodes the item at the start of src. Returns its type, its value, and the
+// encoded length including padding. Safe on untrusted input.
+func DecodeV1Item(src []byte) (typ byte, val any, length int, err error) {
+
+	if len(src) < V1_ITEM_HDR_LEN {
+		return 0, nil, 0, ErrShortBuffer
+	}
+	typ = src[0]
+	vlen := int(src[1])
+	length = V1ItemLen(vlen)
+	if len(src) < length {
+		return 0, nil, 0, ErrShortBuffer
+	}
+	raw := src[V1_ITEM_HDR_LEN:V1_ITEM_HDR_LEN+vlen]
+	if it, ok := LookupV1Item(typ); ok {
+		val, err = it.Decode(raw)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+	} else {
+		val = append([]byte(nil), raw...)
+	}
+	return typ, val, length, nil
+}
+
+func init() {
+
+	RegisterV1Item(V1_TYPE_NONE, V1ItemType{
+		Name: "NONE",
+		Encode: func(dst []byte, val any) ([]byte, error) {
+			if val != nil {
+				return dst, ErrV1ItemValue
+			}
+			return dst, nil
+		},
+		Decode: func(val []byte) (any, error) {
+			if len(val) != 0 {
+				return nil, ErrV1Malformed
+			}
+			return nil, nil
+		},
+	})
+	RegisterV1Item(V1_TYPE_IPV4, V1ItemType{
+		Name: "IPV4",
+		Encode: func(dst []byte, val any) ([]byte, error) {
+			ip, ok := val.(IP)
+			if !ok || ip.IsZero() || !ip.Is4() {
+				return dst, ErrV1ItemValue
+			}
+			return append(dst, ip.AsSlice()...), nil
+		},
+		Decode: func(val []byte) (any, error) {
+			if len(val) != 4 {
+				return nil, ErrV1Malformed
+			}
+			return IPFromSlice(val), nil
+		},
+	})
+	RegisterV1Item(V1_TYPE_STRING, V1ItemType{
+		Name: "STRING",
+		Encode: func(dst []byte, val any) ([]byte, error) {
+			s, ok := val.(string)
+			if !ok {
+				return dst, ErrV1ItemValue
+			}
+			return append(dst, s...), nil
+		},
+		Decode: func(val []byte) (any, error) {
+			return string(val), nil
+		},
+	})
+}
@@ -0,0 +1,73 @@
+/* Copyright (c) 2025 Waldemar Augustyn */
+
+package ref
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestV1Items(t *testing.T) {
+
+	test_cases := []struct {
+		typ byte
+		val any
+		enc []byte
+	}{
+		{V1_TYPE_NONE, nil, []byte{0, 0, 0, 0}},
+		{V1_TYPE_IPV4, MustParseIP("192.0.2.1"), []byte{3, 4, 192, 0, 2, 1, 0, 0}},
+		{V1_TYPE_STRING, "", []byte{4, 0, 0, 0}},
+		{V1_TYPE_STRING, "ab", []byte{4, 2, 'a', 'b'}},
+		{V1_TYPE_STRING, "abc", []byte{4, 3, 'a', 'b', 'c', 0, 0, 0}},
+		{200, []byte{1, 2, 3}, []byte{200, 3, 1, 2, 3, 0, 0, 0}},
+	}
+	for i, c := range test_cases {
+		enc, err := AppendV1Item([]byte{9}, c.typ, c.val)
+		if err != nil || string(enc[1:]) != string(c.enc) {
+			t.Errorf("case %v: expected % x, got % x %v", i, c.enc, enc[1:], err)
+			continue
+		}
+		typ, val, n, err := DecodeV1Item(append(enc[1:], 0xff))
+		if err != nil || typ != c.typ || n != len(c.enc) || !reflect.DeepEqual(val, c.val) {
+			t.Errorf("case %v: decoded %v %v %v %v", i, typ, val, n, err)
+		}
+	}
+
+	if _, err := AppendV1Item(nil, V1_TYPE_STRING, string(make([]byte, 256))); !errors.Is(err, ErrV1ItemTooLong) {
+		t.Errorf("expected ErrV1ItemTooLong, got %v", err)
+	}
+	if _, err := AppendV1Item(nil, V1_TYPE_IPV4, "x"); !errors.Is(err, ErrV1ItemValue) {
+		t.Errorf("expected ErrV1ItemValue, got %v", err)
+	}
+	if _, err := AppendV1Item(nil, 201, "x"); !errors.Is(err, ErrV1ItemType) {
+		t.Errorf("expected ErrV1ItemType, got %v", err)
+	}
+	if _, _, _, err := DecodeV1Item([]byte{4, 3, 'a', 'b', 'c'}); !errors.Is(err, ErrShortBuffer) {
+		t.Errorf("expected ErrShortBuffer for missing padding, got %v", err)
+	}
+	if _, _, _, err := DecodeV1Item([]byte{3, 2, 1, 2}); !errors.Is(err, ErrV1Malformed) {
+		t.Errorf("expected ErrV1Malformed for short IPV4, got %v", err)
+	}
+
+	register_test_item(t, 202, V1ItemType{
+		Name: "U16",
+		Encode: func(dst []byte, val any) ([]byte, error) {
+			return be.AppendUint16(dst, val.(uint16)), nil
+		},
+		Decode: func(val []byte) (any, error) {
+			return be.Uint16(val), nil
+		},
+	})
+	enc, _ := AppendV1Item(nil, 202, uint16(0x1234))
+	if _, val, _, err := DecodeV1Item(enc); err != nil || val != uint16(0x1234) || V1ItemName(202) != "U16" {
+		t.Errorf("registered type decoded as %v %v", val, err)
+	}
+}
+
+// Registers the item type for the duration of the test.
+func register_test_item(t *testing.T, typ byte, it V1ItemType) {
+
+	RegisterV1Item(typ, it)
+	t.Cleanup(func() { unregister_v1_item(typ) })
+}